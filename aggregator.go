@@ -0,0 +1,158 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// aggregator accumulates the statistics of responses as they complete, so that the responses
+// themselves need not be kept in memory.
+type aggregator struct {
+	count    int
+	times    *Percentages
+	phases   *Phases
+	statuses map[int]int
+	summary  StatusSummary
+	first    time.Time // Earliest start time.
+	last     time.Time // Latest start time.
+	ended    time.Time // Latest end time.
+	errors   int       // Number of responses which errored, had a 5xx status or failed assertions.
+	passed   int       // Number of responses which passed all the assertions.
+	failed   int       // Number of responses which failed at least one assertion.
+	failures map[string]*AssertionFailures
+	series   *TimeSeries // Statistics bucketed by completion time, if tracked.
+}
+
+// newAggregator returns an empty aggregator.
+func newAggregator() *aggregator {
+	return &aggregator{times: NewPercentages(nil), phases: newPhases(), statuses: make(map[int]int),
+		failures: make(map[string]*AssertionFailures)}
+}
+
+// newSeriesAggregator returns an empty aggregator which also tracks the time series.
+func newSeriesAggregator() *aggregator {
+	a := newAggregator()
+	a.series = newTimeSeries()
+	return a
+}
+
+// add accumulates the statistics of the provided response.
+func (a *aggregator) add(resp *Response) {
+	a.count++
+	a.times.Record(resp.duration)
+	a.phases.record(resp.timing)
+	if a.first.IsZero() || resp.started.Before(a.first) {
+		a.first = resp.started
+	}
+	if resp.started.After(a.last) {
+		a.last = resp.started
+	}
+	ended := resp.started.Add(resp.duration)
+	if ended.After(a.ended) {
+		a.ended = ended
+	}
+	errored := resp.errored()
+	if errored {
+		a.errors++
+	}
+	if a.series != nil {
+		a.series.add(resp, ended, errored)
+	}
+	if resp.asserted {
+		if resp.failures == nil {
+			a.passed++
+		} else {
+			a.failed++
+		}
+		for _, failure := range resp.failures {
+			if _, exists := a.failures[failure.Check]; !exists {
+				a.failures[failure.Check] = &AssertionFailures{Check: failure.Check, Sample: failure.Message}
+			}
+			a.failures[failure.Check].Count++
+		}
+	}
+	a.summary.record(resp.statusCode)
+	if resp.statusCode != -1 {
+		a.statuses[resp.statusCode]++
+	}
+}
+
+// merge accumulates the statistics of the provided aggregator.
+func (a *aggregator) merge(o *aggregator) {
+	a.count += o.count
+	a.times.Merge(o.times)
+	a.phases.merge(o.phases)
+	if !o.first.IsZero() && (a.first.IsZero() || o.first.Before(a.first)) {
+		a.first = o.first
+	}
+	if o.last.After(a.last) {
+		a.last = o.last
+	}
+	if o.ended.After(a.ended) {
+		a.ended = o.ended
+	}
+	a.errors += o.errors
+	if a.series != nil && o.series != nil {
+		a.series.merge(o.series)
+	}
+	for code, count := range o.statuses {
+		a.statuses[code] += count
+	}
+	a.passed += o.passed
+	a.failed += o.failed
+	for check, failures := range o.failures {
+		if _, exists := a.failures[check]; !exists {
+			a.failures[check] = &AssertionFailures{Check: check, Sample: failures.Sample}
+		}
+		a.failures[check].Count += failures.Count
+	}
+	a.summary.merge(&o.summary)
+}
+
+// Statuses returns the status breakdown.
+func (a *aggregator) Statuses() []Status {
+	statuses := make([]Status, 0, len(a.statuses))
+	for code, count := range a.statuses {
+		statuses = append(statuses, Status{Code: code, Count: count})
+	}
+	return statuses
+}
+
+// Summary returns a copy of the status summary.
+func (a *aggregator) Summary() *StatusSummary {
+	summary := a.summary
+	return &summary
+}
+
+// Assertions returns the assertion summary, with the most frequent failures first.
+func (a *aggregator) Assertions() *AssertionSummary {
+	summary := &AssertionSummary{Passed: a.passed, Failed: a.failed, Failures: []*AssertionFailures{}}
+	for _, failures := range a.failures {
+		summary.Failures = append(summary.Failures, &AssertionFailures{Check: failures.Check, Count: failures.Count, Sample: failures.Sample})
+	}
+	sort.Slice(summary.Failures, func(i, j int) bool {
+		if summary.Failures[i].Count != summary.Failures[j].Count {
+			return summary.Failures[i].Count > summary.Failures[j].Count
+		}
+		return summary.Failures[i].Check < summary.Failures[j].Check
+	})
+	return summary
+}
+
+// throughput returns the number of responses per second, from the first start to the last end.
+func (a *aggregator) throughput() float64 {
+	elapsed := a.ended.Sub(a.first).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(a.count) / elapsed
+}
+
+// startRate returns the rate, in requests per second, at which the requests were started.
+func (a *aggregator) startRate() float64 {
+	elapsed := a.last.Sub(a.first).Seconds()
+	if a.count < 2 || elapsed == 0 {
+		return 0
+	}
+	return float64(a.count-1) / elapsed
+}
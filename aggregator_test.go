@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAggregator(t *testing.T) {
+	Convey("Testing the aggregation of responses", t, func() {
+		start := time.Now()
+		a := newAggregator()
+		a.add(&Response{statusCode: 200, started: start.Add(time.Second), duration: time.Millisecond * 10})
+		a.add(&Response{statusCode: 200, started: start, duration: time.Millisecond * 20})
+		a.add(&Response{statusCode: 503, started: start.Add(time.Second * 2), duration: time.Millisecond * 30})
+		a.add(&Response{statusCode: -1, started: start.Add(time.Millisecond * 500)})
+		So(a.count, ShouldEqual, 4)
+		So(a.times.Len(), ShouldEqual, 4)
+		So(a.Summary(), ShouldResemble, &StatusSummary{S2xx: 2, S5xx: 1, None: 1})
+		So(a.Statuses(), ShouldContain, Status{Code: 200, Count: 2})
+		So(a.Statuses(), ShouldContain, Status{Code: 503, Count: 1})
+		So(a.first, ShouldEqual, start)
+		So(a.startRate(), ShouldEqual, 1.5)
+		So(a.errors, ShouldEqual, 2)
+		So(a.throughput(), ShouldAlmostEqual, 4/2.03, 0.0001)
+
+		o := newAggregator()
+		o.add(&Response{statusCode: 404, started: start.Add(time.Second * 3), duration: time.Millisecond})
+		a.merge(o)
+		So(a.count, ShouldEqual, 5)
+		So(a.times.Len(), ShouldEqual, 5)
+		So(a.Summary().S4xx, ShouldEqual, 1)
+		So(a.last, ShouldEqual, start.Add(time.Second*3))
+		So(newAggregator().startRate(), ShouldEqual, 0)
+
+		Convey("Only the series aggregator tracks the time series", func() {
+			So(a.series, ShouldBeNil)
+			s := newSeriesAggregator()
+			s.add(&Response{statusCode: 200, started: start, duration: time.Millisecond * 10})
+			s.add(&Response{statusCode: 500, started: start.Add(time.Second), duration: time.Millisecond * 10})
+			o := newSeriesAggregator()
+			o.add(&Response{statusCode: 200, started: start.Add(time.Second * 2), duration: time.Millisecond * 10})
+			s.merge(o)
+			So(len(s.series.Buckets), ShouldEqual, 3)
+			So(s.series.Buckets[1].Errors, ShouldEqual, 1)
+			So(s.series.Buckets[2].Requests, ShouldEqual, 1)
+		})
+		Convey("Failed assertions are counted per check", func() {
+			a := newAggregator()
+			a.add(&Response{statusCode: 200, asserted: true})
+			a.add(&Response{statusCode: 200, asserted: true, failures: []*AssertionFailure{{Check: "body contains ok", Message: "first"}}})
+			a.add(&Response{statusCode: 500, asserted: true, failures: []*AssertionFailure{
+				{Check: "status 2xx", Message: "got status 500"}, {Check: "body contains ok", Message: "second"}}})
+			a.add(&Response{statusCode: -1})
+			So(a.Assertions(), ShouldResemble, &AssertionSummary{Passed: 1, Failed: 2, Failures: []*AssertionFailures{
+				{Check: "body contains ok", Count: 2, Sample: "first"}, {Check: "status 2xx", Count: 1, Sample: "got status 500"}}})
+		})
+	})
+}
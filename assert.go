@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ResponseAssertion defines the checks which each response must pass to be considered successful.
+type ResponseAssertion struct {
+	Status     string             `xml:"status,attr,omitempty" json:"status,omitempty" yaml:"status,omitempty"`  // Comma separated status codes or ranges, e.g. "200,201-204" or "2xx".
+	MaxLatency Duration           `xml:"maxLatency,attr" json:"maxLatency,omitzero" yaml:"maxLatency,omitempty"` // Longest acceptable response time.
+	Headers    []*HeaderAssertion `xml:"header" json:"headers,omitempty" yaml:"headers,omitempty"`               // Headers which must be present, optionally with a given value.
+	Bodies     []*BodyAssertion   `xml:"body" json:"bodies,omitempty" yaml:"bodies,omitempty"`                   // Substrings or regular expressions which the body must match.
+	Fields     []*JSONAssertion   `xml:"json" json:"json,omitempty" yaml:"json,omitempty"`                       // JSON fields which must have a given value.
+	statuses   [][2]int           // Inclusive ranges of the expected status codes.
+}
+
+// HeaderAssertion checks the presence, and optionally the value, of a response header.
+type HeaderAssertion struct {
+	Name  string `xml:"name,attr" json:"name" yaml:"name"`
+	Value string `xml:"value,attr,omitempty" json:"value,omitempty" yaml:"value,omitempty"`
+}
+
+// BodyAssertion checks that the response body contains a substring or matches a regular expression.
+type BodyAssertion struct {
+	Contains string `xml:"contains,attr,omitempty" json:"contains,omitempty" yaml:"contains,omitempty"`
+	Regex    string `xml:"regex,attr,omitempty" json:"regex,omitempty" yaml:"regex,omitempty"`
+	re       *regexp.Regexp
+}
+
+// JSONAssertion checks the value of a field of a JSON response. Nested fields are separated by dots, e.g. "data.id".
+type JSONAssertion struct {
+	Field  string `xml:"field,attr" json:"field" yaml:"field"`
+	Equals string `xml:"equals,attr" json:"equals" yaml:"equals"` // Either a JSON literal, e.g. `true` or `12`, or a plain string.
+	value  interface{}
+}
+
+// AssertionFailure is a failed check of an assertion, along with a description of why it failed.
+type AssertionFailure struct {
+	Check   string
+	Message string
+}
+
+// Validate confirms that an assertion is correctly defined and initializes variables.
+// It returns all the problems of the assertion as ValidationErrors.
+func (a *ResponseAssertion) Validate() error {
+	errs := ValidationErrors{}
+	if a.Status != "" {
+		for _, part := range strings.Split(a.Status, ",") {
+			part = strings.TrimSpace(part)
+			var codes [2]int
+			var err error
+			if strings.HasSuffix(strings.ToLower(part), "xx") && len(part) == 3 {
+				var class int
+				class, err = strconv.Atoi(part[:1])
+				codes = [2]int{class * 100, class*100 + 99}
+			} else if bounds := strings.Split(part, "-"); len(bounds) == 2 {
+				if codes[0], err = strconv.Atoi(strings.TrimSpace(bounds[0])); err == nil {
+					codes[1], err = strconv.Atoi(strings.TrimSpace(bounds[1]))
+				}
+			} else {
+				codes[0], err = strconv.Atoi(part)
+				codes[1] = codes[0]
+			}
+			if err != nil || codes[0] < 100 || codes[1] > 599 || codes[0] > codes[1] {
+				errs.add("", fmt.Errorf("invalid expected status `%s`", part))
+				continue
+			}
+			a.statuses = append(a.statuses, codes)
+		}
+	}
+	if a.MaxLatency.Duration < 0 {
+		errs.add("", errors.New("maximum latency of an assertion cannot be negative"))
+	}
+	for hno, header := range a.Headers {
+		if header.Name == "" {
+			errs.add(elementPath("", "header", hno+1, ""), errors.New("header assertion requires a name"))
+		}
+	}
+	for bno, body := range a.Bodies {
+		path := elementPath("", "body", bno+1, "")
+		if (body.Contains == "") == (body.Regex == "") {
+			errs.add(path, errors.New("body assertion requires either contains or regex"))
+		} else if body.Regex != "" {
+			var err error
+			if body.re, err = regexp.Compile(body.Regex); err != nil {
+				errs.add(path, fmt.Errorf("invalid body regex `%s`: %s", body.Regex, err))
+			}
+		}
+	}
+	for fno, field := range a.Fields {
+		if field.Field == "" {
+			errs.add(elementPath("", "json", fno+1, ""), errors.New("json assertion requires a field"))
+		}
+		if err := json.Unmarshal([]byte(field.Equals), &field.value); err != nil {
+			// Not a JSON literal, so the field must be equal to this string.
+			field.value = field.Equals
+		}
+	}
+	return errs.orNil()
+}
+
+// Check returns the failed checks of this assertion for the provided response and its body.
+func (a *ResponseAssertion) Check(resp *Response, body []byte) (failures []*AssertionFailure) {
+	fail := func(check string, format string, args ...interface{}) {
+		failures = append(failures, &AssertionFailure{Check: check, Message: fmt.Sprintf(format, args...)})
+	}
+	if a.statuses != nil {
+		expected := false
+		for _, codes := range a.statuses {
+			if resp.statusCode >= codes[0] && resp.statusCode <= codes[1] {
+				expected = true
+				break
+			}
+		}
+		if !expected {
+			fail("status "+a.Status, "got status %d", resp.statusCode)
+		}
+	}
+	if a.MaxLatency.Duration > 0 && resp.duration > a.MaxLatency.Duration {
+		fail("latency under "+a.MaxLatency.String(), "took %s", resp.duration)
+	}
+	for _, header := range a.Headers {
+		values, present := resp.header[http.CanonicalHeaderKey(header.Name)]
+		if header.Value == "" {
+			if !present {
+				fail("header "+header.Name, "header is missing")
+			}
+		} else if got := strings.Join(values, ", "); got != header.Value {
+			fail(fmt.Sprintf("header %s is %s", header.Name, header.Value), "got `%s`", got)
+		}
+	}
+	for _, bdy := range a.Bodies {
+		if bdy.re != nil {
+			if !bdy.re.Match(body) {
+				fail("body matches "+bdy.Regex, "body does not match")
+			}
+		} else if !strings.Contains(string(body), bdy.Contains) {
+			fail("body contains "+bdy.Contains, "body does not contain it")
+		}
+	}
+	for _, field := range a.Fields {
+		check := fmt.Sprintf("json %s is %s", field.Field, field.Equals)
+		value, err := resp.field(field.Field)
+		if err != nil {
+			fail(check, "%s", err)
+		} else if !reflect.DeepEqual(value, field.value) {
+			fail(check, "got `%v`", value)
+		}
+	}
+	return
+}
+
+// field returns the value of a (possibly nested) field of the JSON response.
+func (resp *Response) field(path string) (value interface{}, err error) {
+	keys := strings.Split(path, ".")
+	raw, present := resp.JSON[keys[0]]
+	if !present {
+		return nil, fmt.Errorf("field %s is missing", keys[0])
+	}
+	if err = json.Unmarshal(raw, &value); err != nil {
+		return nil, err
+	}
+	for _, key := range keys[1:] {
+		object, isObject := value.(map[string]interface{})
+		if !isObject {
+			return nil, fmt.Errorf("field %s is not an object", key)
+		}
+		if value, present = object[key]; !present {
+			return nil, fmt.Errorf("field %s is missing", key)
+		}
+	}
+	return
+}
+
+// AssertionSummary stores the assertion results of a group of requests.
+type AssertionSummary struct {
+	Passed   int                  `xml:"passed,attr"`
+	Failed   int                  `xml:"failed,attr"`
+	Failures []*AssertionFailures `xml:"failure"`
+}
+
+// AssertionFailures stores how many times a check failed, along with a sample failure message.
+type AssertionFailures struct {
+	Check  string `xml:"check,attr"`
+	Count  int    `xml:"count,attr"`
+	Sample string `xml:"sample,attr"`
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAssertion(t *testing.T) {
+	Convey("Testing assertions", t, func() {
+		Convey("Invalid assertions should fail validation", func() {
+			for _, assertXML := range []string{
+				`<assert status="abc" />`,
+				`<assert status="299-200" />`,
+				`<assert status="700" />`,
+				`<assert><header value="text/plain" /></assert>`,
+				`<assert><body /></assert>`,
+				`<assert><body contains="a" regex="b" /></assert>`,
+				`<assert><body regex="(" /></assert>`,
+				`<assert><json equals="ok" /></assert>`,
+			} {
+				a := ResponseAssertion{}
+				So(xml.Unmarshal([]byte(assertXML), &a), ShouldBeNil)
+				So(a.Validate(), ShouldNotBeNil)
+			}
+		})
+		Convey("Each check should report its failures", func() {
+			a := ResponseAssertion{}
+			xml.Unmarshal([]byte(`<assert status="200,201-204,3xx" maxLatency="100ms">
+				<header name="content-type" value="application/json" />
+				<header name="X-Request-Id" />
+				<body contains="ok" />
+				<body regex="^\{.*\}$" />
+				<json field="status" equals="ok" />
+				<json field="data.count" equals="2" />
+				<json field="data.valid" equals="true" />
+			</assert>`), &a)
+			So(a.Validate(), ShouldBeNil)
+			body := []byte(`{"status": "ok", "data": {"count": 2, "valid": true}}`)
+			resp := &Response{statusCode: 203, duration: time.Millisecond,
+				header: http.Header{"Content-Type": {"application/json"}, "X-Request-Id": {"1"}}}
+			json.Unmarshal(body, &resp.JSON)
+			So(a.Check(resp, body), ShouldBeEmpty)
+
+			resp.statusCode = 304
+			So(a.Check(resp, body), ShouldBeEmpty)
+
+			body = []byte(`<html>error</html>`)
+			resp = &Response{statusCode: 500, duration: time.Second, header: http.Header{"Content-Type": {"text/html"}}}
+			json.Unmarshal(body, &resp.JSON)
+			failures := a.Check(resp, body)
+			checks := []string{}
+			for _, failure := range failures {
+				checks = append(checks, fmt.Sprintf("%s: %s", failure.Check, failure.Message))
+			}
+			So(checks, ShouldResemble, []string{
+				"status 200,201-204,3xx: got status 500",
+				"latency under 100ms: took 1s",
+				"header content-type is application/json: got `text/html`",
+				"header X-Request-Id: header is missing",
+				"body contains ok: body does not contain it",
+				"body matches ^\\{.*\\}$: body does not match",
+				"json status is ok: field status is missing",
+				"json data.count is 2: field data is missing",
+				"json data.valid is true: field data is missing",
+			})
+
+			body = []byte(`{"status": "ko", "data": "none"}`)
+			resp = &Response{statusCode: 200}
+			json.Unmarshal(body, &resp.JSON)
+			a = ResponseAssertion{Fields: []*JSONAssertion{{Field: "status", Equals: "ok"}, {Field: "data.count", Equals: "2"}}}
+			a.Validate()
+			failures = a.Check(resp, body)
+			So(len(failures), ShouldEqual, 2)
+			So(failures[0].Message, ShouldEqual, "got `ko`")
+			So(failures[1].Message, ShouldEqual, "field count is not an object")
+		})
+		Convey("Failed assertions should be counted in the result", func() {
+			var calls int
+			var callsMutex sync.Mutex
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				callsMutex.Lock()
+				calls++
+				failing := calls%4 == 0
+				callsMutex.Unlock()
+				if failing {
+					w.Write([]byte(`<html>Something went wrong</html>`))
+					return
+				}
+				w.Write([]byte(`{"status": "ok"}`))
+			}))
+			defer ts.Close()
+			profile = &Profile{UserAgent: "StressGauge/0.x"}
+			r := Request{Method: "get", Repeat: 20, Concurrency: 2, URL: &URL{Base: ts.URL},
+				Assert: &ResponseAssertion{Status: "2xx", Fields: []*JSONAssertion{{Field: "status", Equals: "ok"}}}}
+			r.Validate()
+			var wg sync.WaitGroup
+			r.Spawn(nil, &wg)
+			wg.Wait()
+			So(r.Result.StatusSum.S2xx, ShouldEqual, 20)
+			So(r.Result.Assertions, ShouldResemble, &AssertionSummary{Passed: 15, Failed: 5,
+				Failures: []*AssertionFailures{{Check: "json status is ok", Count: 5, Sample: "field status is missing"}}})
+			b, _ := xml.Marshal(r.Result.Assertions)
+			So(string(b), ShouldEqual, `<AssertionSummary passed="15" failed="5"><failure check="json status is ok" count="5" sample="field status is missing"></failure></AssertionSummary>`)
+		})
+	})
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// comparedResult is a result loaded from a saved file, as compared between two runs.
+type comparedResult struct {
+	Test     string
+	Name     string // Chain of the requests from the top level one, e.g. "POST /login > GET /items".
+	Requests int
+	Errors   int
+	Times    []comparedTime // In the order they were saved: mean, shortest, percentiles and longest.
+	Statuses map[int]int
+}
+
+// comparedTime is a named response time of a compared result, e.g. p99.
+type comparedTime struct {
+	Name     string
+	Duration time.Duration
+}
+
+// matchKeys returns the key on which each result is matched between two runs. Results which share
+// the same test and request chain are matched in order.
+func matchKeys(results []*comparedResult) []string {
+	seen := map[string]int{}
+	keys := make([]string, len(results))
+	for i, c := range results {
+		key := c.Test + "\x00" + c.Name
+		seen[key]++
+		keys[i] = fmt.Sprintf("%s\x00%d", key, seen[key])
+	}
+	return keys
+}
+
+// ErrorRate returns the percentage of the requests which errored, had a 5xx status or failed assertions.
+func (c *comparedResult) ErrorRate() float64 {
+	if c.Requests == 0 {
+		return 0
+	}
+	return float64(c.Errors) / float64(c.Requests) * 100
+}
+
+// savedXMLProfile is the subset of a saved XML result which is compared.
+type savedXMLProfile struct {
+	Tests []*struct {
+		Name    string            `xml:"name,attr"`
+		Results []*savedXMLResult `xml:"result"`
+	} `xml:"Profile>test"`
+}
+
+// savedXMLResult is the subset of a saved XML result of a request which is compared.
+type savedXMLResult struct {
+	Method string `xml:"method,attr"`
+	URL    string `xml:"url,attr"`
+	Errors int    `xml:"errors,attr"`
+	Times  struct {
+		Count  int `xml:"count,attr"`
+		Values []*struct {
+			XMLName  xml.Name
+			Duration Duration `xml:"duration,attr"`
+		} `xml:",any"`
+	} `xml:"times"`
+	Statuses []Status          `xml:"status"`
+	Spawned  []*savedXMLResult `xml:"spawned"`
+}
+
+// loadComparedResults loads the results saved in the provided XML or JSON file, including the spawned ones.
+func loadComparedResults(filename string) ([]*comparedResult, error) {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	results := []*comparedResult{}
+	if filepath.Ext(filename) == ".json" {
+		saved := JSONProfile{}
+		if err := json.Unmarshal(content, &saved); err != nil {
+			return nil, fmt.Errorf("could not load %s: %s", filename, err)
+		}
+		var visit func(test string, jrs []*JSONResult, parent string)
+		visit = func(test string, jrs []*JSONResult, parent string) {
+			for _, jr := range jrs {
+				c := &comparedResult{Test: test, Name: chainName(parent, jr.Method, jr.URL), Errors: jr.Errors, Statuses: map[int]int{}}
+				if jr.Times != nil {
+					c.Requests = jr.Times.Count
+					c.Times = append(c.Times, comparedTime{"mean", fromMilliseconds(jr.Times.MeanMs)},
+						comparedTime{"shortest", fromMilliseconds(jr.Times.ShortestMs)})
+					percentiles := []string{}
+					for name := range jr.Times.Percentiles {
+						percentiles = append(percentiles, name)
+					}
+					sort.Slice(percentiles, func(i, j int) bool {
+						pi, _ := strconv.ParseFloat(strings.TrimPrefix(percentiles[i], "p"), 64)
+						pj, _ := strconv.ParseFloat(strings.TrimPrefix(percentiles[j], "p"), 64)
+						return pi < pj
+					})
+					for _, name := range percentiles {
+						c.Times = append(c.Times, comparedTime{name, fromMilliseconds(jr.Times.Percentiles[name])})
+					}
+					c.Times = append(c.Times, comparedTime{"longest", fromMilliseconds(jr.Times.LongestMs)})
+				}
+				for code, count := range jr.Statuses {
+					if no, err := strconv.Atoi(code); err == nil {
+						c.Statuses[no] = count
+					}
+				}
+				results = append(results, c)
+				visit(test, jr.Spawned, c.Name)
+			}
+		}
+		for _, test := range saved.Tests {
+			visit(test.Name, test.Results, "")
+		}
+		return results, nil
+	}
+	saved := savedXMLProfile{}
+	if err := xml.Unmarshal(content, &saved); err != nil {
+		return nil, fmt.Errorf("could not load %s: %s", filename, err)
+	}
+	var visit func(test string, srs []*savedXMLResult, parent string)
+	visit = func(test string, srs []*savedXMLResult, parent string) {
+		for _, sr := range srs {
+			c := &comparedResult{Test: test, Name: chainName(parent, sr.Method, sr.URL), Requests: sr.Times.Count, Errors: sr.Errors,
+				Statuses: map[int]int{}}
+			for _, value := range sr.Times.Values {
+				if value.XMLName.Local != "stddev" { // The standard deviation is not a response time.
+					c.Times = append(c.Times, comparedTime{value.XMLName.Local, value.Duration.Duration})
+				}
+			}
+			for _, status := range sr.Statuses {
+				c.Statuses[status.Code] = status.Count
+			}
+			results = append(results, c)
+			visit(test, sr.Spawned, c.Name)
+		}
+	}
+	for _, test := range saved.Tests {
+		visit(test.Name, test.Results, "")
+	}
+	return results, nil
+}
+
+// chainName returns the name of a request, chained to that of its parent if any.
+func chainName(parent, method, url string) string {
+	name := fmt.Sprintf("%s %s", method, url)
+	if parent != "" {
+		name = parent + " > " + name
+	}
+	return name
+}
+
+// fromMilliseconds converts milliseconds to a duration.
+func fromMilliseconds(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
+
+// Tolerances define how much worse a new result may be than an old one before it is a regression.
+type Tolerances struct {
+	Latency  float64       // Allowed increase of each response time, in percent.
+	MinDelta time.Duration // Increases of response times below this are never regressions, in order to ignore noise.
+	Errors   float64       // Allowed increase of the error rate, in percentage points.
+}
+
+// compareResults writes the deltas between the old and new results, matched by test and request chain,
+// and returns the number of regressions.
+func compareResults(before, after []*comparedResult, tolerances Tolerances, out io.Writer) int {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	regressions := 0
+	mark := func(regressed bool) string {
+		if regressed {
+			regressions++
+			return "REGRESSION"
+		}
+		return ""
+	}
+	olds := map[string]*comparedResult{}
+	oldKeys := matchKeys(before)
+	for i, o := range before {
+		olds[oldKeys[i]] = o
+	}
+	matched := map[string]bool{}
+	for i, key := range matchKeys(after) {
+		n := after[i]
+		o, exists := olds[key]
+		if !exists {
+			fmt.Fprintf(w, "%s: %s\n\tonly in the new results\n\n", n.Test, n.Name)
+			continue
+		}
+		matched[key] = true
+		fmt.Fprintf(w, "%s: %s\n\t\told\tnew\tdelta\t\n", n.Test, n.Name)
+		fmt.Fprintf(w, "\trequests\t%d\t%d\t%+d\t\n", o.Requests, n.Requests, n.Requests-o.Requests)
+		oldTimes := map[string]time.Duration{}
+		for _, t := range o.Times {
+			oldTimes[t.Name] = t.Duration
+		}
+		for _, t := range n.Times {
+			was, exists := oldTimes[t.Name]
+			if !exists {
+				continue // This percentile was not reported by the old run.
+			}
+			delta := t.Duration - was
+			relative := "n/a"
+			if was > 0 {
+				relative = fmt.Sprintf("%+.1f%%", float64(delta)/float64(was)*100)
+			}
+			regressed := delta > tolerances.MinDelta && float64(t.Duration) > float64(was)*(1+tolerances.Latency/100)
+			fmt.Fprintf(w, "\t%s\t%s\t%s\t%s\t%s\n", t.Name, was, t.Duration, relative, mark(regressed))
+		}
+		fmt.Fprintf(w, "\terror rate\t%.2f%%\t%.2f%%\t%+.2fpp\t%s\n", o.ErrorRate(), n.ErrorRate(), n.ErrorRate()-o.ErrorRate(),
+			mark(n.ErrorRate()-o.ErrorRate() > tolerances.Errors))
+		codes := []int{}
+		for code := range o.Statuses {
+			codes = append(codes, code)
+		}
+		for code := range n.Statuses {
+			if _, exists := o.Statuses[code]; !exists {
+				codes = append(codes, code)
+			}
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(w, "\tstatus %d\t%d\t%d\t%+d\t\n", code, o.Statuses[code], n.Statuses[code], n.Statuses[code]-o.Statuses[code])
+		}
+		fmt.Fprintln(w)
+	}
+	for i, o := range before {
+		if !matched[oldKeys[i]] {
+			fmt.Fprintf(w, "%s: %s\n\tonly in the old results\n\n", o.Test, o.Name)
+		}
+	}
+	return regressions
+}
+
+// compareCommand implements `sg compare [flags] old new`, and returns the exit code:
+// 0 without regression, 1 with regressions and 2 if the results cannot be loaded.
+func compareCommand(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("compare", flag.ContinueOnError)
+	fs.SetOutput(out)
+	tolerances := Tolerances{}
+	fs.Float64Var(&tolerances.Latency, "latency-tolerance", 10, "allowed increase of each response time, in percent")
+	fs.DurationVar(&tolerances.MinDelta, "min-delta", time.Millisecond, "increases of response times below this are never regressions")
+	fs.Float64Var(&tolerances.Errors, "error-tolerance", 0, "allowed increase of the error rate, in percentage points")
+	fs.Usage = func() {
+		fmt.Fprintln(out, "usage: sg compare [flags] old.xml new.xml")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return 2
+	}
+	before, err := loadComparedResults(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+	after, err := loadComparedResults(fs.Arg(1))
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+	if regressions := compareResults(before, after, tolerances, out); regressions > 0 {
+		fmt.Fprintf(out, "%d regression(s) from %s to %s.\n", regressions, fs.Arg(0), fs.Arg(1))
+		return 1
+	}
+	fmt.Fprintf(out, "No regression from %s to %s.\n", fs.Arg(0), fs.Arg(1))
+	return 0
+}
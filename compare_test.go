@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// savedRun saves a run whose responses all took the provided time, with errors on the top result, and returns its filenames.
+func savedRun(filename string, duration time.Duration, errors int, extra bool) []string {
+	times := []time.Duration{}
+	for i := 0; i < 100; i++ {
+		times = append(times, duration)
+	}
+	child := &Result{Method: "GET", URL: "http://example.org/items", Times: NewPercentages(times[:10]), Statuses: []Status{{Code: 200, Count: 10}},
+		StatusSum: &StatusSummary{S2xx: 10}}
+	top := &Result{Method: "POST", URL: "http://example.org/login", Times: NewPercentages(times), Errors: errors,
+		Statuses: []Status{{Code: 200, Count: 100 - errors}}, StatusSum: &StatusSummary{S2xx: 100 - errors}, Spawned: []*Result{child}}
+	if errors > 0 {
+		top.Statuses = append(top.Statuses, Status{Code: 500, Count: errors})
+	}
+	requests := []*Request{{Result: top}}
+	if extra {
+		requests = append(requests, &Request{Result: &Result{Method: "GET", URL: "http://example.org/new", Times: NewPercentages(times)}})
+	}
+	p := &Profile{Name: "Compare", Tests: []*StressTest{{Name: "Release", Requests: requests}}}
+	return saveResult(p, filename)
+}
+
+func TestCompare(t *testing.T) {
+	Convey("Testing the comparison of two results", t, func() {
+		defer func(format string) { outputFormat = format }(outputFormat)
+		outputFormat = "both"
+		dir, _ := ioutil.TempDir("", "sg")
+		defer os.RemoveAll(dir)
+		old := savedRun(filepath.Join(dir, "old.xml"), time.Millisecond*10, 0, false)
+		same := savedRun(filepath.Join(dir, "same.xml"), time.Millisecond*10, 0, false)
+		slower := savedRun(filepath.Join(dir, "slower.xml"), time.Millisecond*30, 5, true)
+
+		Convey("Results are loaded from both XML and JSON files", func() {
+			for _, filename := range old {
+				results, err := loadComparedResults(filename)
+				So(err, ShouldBeNil)
+				So(len(results), ShouldEqual, 2)
+				So(results[0].Test, ShouldEqual, "Release")
+				So(results[0].Name, ShouldEqual, "POST http://example.org/login")
+				So(results[0].Requests, ShouldEqual, 100)
+				So(results[0].Statuses, ShouldResemble, map[int]int{200: 100})
+				So(results[0].Times[0].Name, ShouldEqual, "mean")
+				So(results[0].Times[len(results[0].Times)-1].Name, ShouldEqual, "longest")
+				So(len(results[0].Times), ShouldEqual, len(reportedPercentiles)+3)
+				So(results[1].Name, ShouldEqual, "POST http://example.org/login > GET http://example.org/items")
+			}
+			_, err := loadComparedResults(filepath.Join(dir, "missing.xml"))
+			So(err, ShouldNotBeNil)
+			ioutil.WriteFile(filepath.Join(dir, "invalid.json"), []byte("{"), 0644)
+			_, err = loadComparedResults(filepath.Join(dir, "invalid.json"))
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Identical runs have no regression", func() {
+			out := &bytes.Buffer{}
+			So(compareCommand([]string{old[0], same[1]}, out), ShouldEqual, 0)
+			So(out.String(), ShouldContainSubstring, "No regression from ")
+			So(out.String(), ShouldNotContainSubstring, "REGRESSION")
+		})
+
+		Convey("Slower responses and more errors are regressions", func() {
+			out := &bytes.Buffer{}
+			So(compareCommand([]string{old[0], slower[0]}, out), ShouldEqual, 1)
+			content := out.String()
+			So(content, ShouldContainSubstring, "Release: POST http://example.org/login\n")
+			So(content, ShouldContainSubstring, "+200.0%")
+			So(content, ShouldContainSubstring, "REGRESSION")
+			So(content, ShouldContainSubstring, "5.00%")
+			So(content, ShouldContainSubstring, "+5.00pp")
+			So(content, ShouldContainSubstring, "status 500")
+			So(content, ShouldContainSubstring, "Release: GET http://example.org/new\n  only in the new results")
+			// The mean, shortest, percentiles and longest of both results, and the error rate of the top one.
+			So(strings.Count(content, "REGRESSION"), ShouldEqual, 2*(len(reportedPercentiles)+3)+1)
+			So(content, ShouldEndWith, "regression(s) from "+old[0]+" to "+slower[0]+".\n")
+
+			Convey("unless they are within the tolerances", func() {
+				out := &bytes.Buffer{}
+				So(compareCommand([]string{"-latency-tolerance", "250", "-error-tolerance", "5", old[0], slower[0]}, out), ShouldEqual, 0)
+				out.Reset()
+				So(compareCommand([]string{"-min-delta", "25ms", "-error-tolerance", "5", old[1], slower[1]}, out), ShouldEqual, 0)
+			})
+			Convey("Results which are no longer run are listed", func() {
+				out := &bytes.Buffer{}
+				compareCommand([]string{slower[0], old[0]}, out)
+				So(out.String(), ShouldContainSubstring, "only in the old results")
+			})
+		})
+
+		Convey("Invalid invocations fail", func() {
+			out := &bytes.Buffer{}
+			So(compareCommand([]string{old[0]}, out), ShouldEqual, 2)
+			So(out.String(), ShouldStartWith, "usage: sg compare")
+			So(compareCommand([]string{"-unknown", old[0], same[0]}, out), ShouldEqual, 2)
+			So(compareCommand([]string{old[0], filepath.Join(dir, "missing.xml")}, out), ShouldEqual, 2)
+			So(runCommand([]string{"unknown"}), ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Include is a profile fragment whose templates and tests are added to those of the including profile.
+type Include struct {
+	File string `xml:"file,attr" json:"file" yaml:"file"` // Path of the fragment, relative to the including profile.
+}
+
+// Template is a named request which requests reference with `use`, e.g. to share a login chain across tests.
+type Template struct {
+	Name    string `xml:"name,attr" json:"name" yaml:"name"`
+	Request `yaml:",inline"`
+}
+
+// readProfileFile reads and decodes a profile file, without validating it, along with the fragments it includes.
+// The variables of the fragments default to the values of those of the including profile. It returns the
+// profile and its resolved data. Files being included are tracked to detect include cycles.
+func readProfileFile(filename string, inherited map[string]string, including map[string]bool) (*Profile, []byte, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	format := profileFormat(filename)
+	data, values, err := resolveVariables(data, format, variableOverrides, inherited)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := decodeProfile(data, format)
+	if err != nil {
+		return nil, nil, err
+	}
+	absolute, _ := filepath.Abs(filename)
+	including[absolute] = true
+	defer delete(including, absolute)
+
+	errs := ValidationErrors{}
+	templates, tests := []*Template{}, []*StressTest{}
+	for ino, include := range p.Includes {
+		path := elementPath("", "include", ino+1, include.File)
+		file := include.File
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(filepath.Dir(filename), file)
+		}
+		if absolute, _ := filepath.Abs(file); including[absolute] {
+			errs.add(path, fmt.Errorf("%s is already being included", include.File))
+			continue
+		}
+		fragment, _, err := readProfileFile(file, values, including)
+		if err != nil {
+			errs.add(path, err)
+			continue
+		}
+		templates = append(templates, fragment.Templates...)
+		tests = append(tests, fragment.Tests...)
+	}
+	// The templates of the profile override those of the same name which it includes.
+	p.Templates = append(templates, p.Templates...)
+	p.Tests = append(tests, p.Tests...)
+	return p, data, errs.orNil()
+}
+
+// applyTemplates sets the fields which the requests of the profile do not define from those of the template
+// they use, if any. It returns the problems as ValidationErrors.
+func (p *Profile) applyTemplates() error {
+	errs := ValidationErrors{}
+	templates := map[string]*Template{}
+	for tno, t := range p.Templates {
+		if t.Name == "" {
+			errs.add(elementPath("", "template", tno+1, ""), errors.New("template name not defined"))
+			continue
+		}
+		templates[t.Name] = t
+	}
+	var apply func(path string, requests []*Request)
+	apply = func(path string, requests []*Request) {
+		for rno, r := range requests {
+			requestPath := elementPath(path, "request", rno+1, "")
+			errs.add(requestPath, r.useTemplate(templates, map[string]bool{}))
+			apply(requestPath, r.Children)
+		}
+	}
+	for tno, test := range p.Tests {
+		path := elementPath("", "test", tno+1, test.Name)
+		apply(path, test.Requests)
+		if test.Mix != nil {
+			apply(joinPath(path, "mix"), test.Mix.Requests)
+		}
+	}
+	return errs.orNil()
+}
+
+// useTemplate sets the fields which the request does not define from those of the template it uses, if any,
+// which may itself use another template. The children of the template come before those of the request.
+func (r *Request) useTemplate(templates map[string]*Template, using map[string]bool) error {
+	if r.Use == "" {
+		return nil
+	}
+	t, exists := templates[r.Use]
+	if !exists {
+		return fmt.Errorf("unknown template `%s`", r.Use)
+	}
+	if using[r.Use] {
+		return fmt.Errorf("template `%s` uses itself", r.Use)
+	}
+	using[r.Use] = true
+	base := t.Request.clone()
+	if err := base.useTemplate(templates, using); err != nil {
+		return err
+	}
+	r.Use = ""
+	if r.Method == "" {
+		r.Method = base.Method
+	}
+	if r.Repeat == 0 {
+		r.Repeat = base.Repeat
+	}
+	if r.Concurrency == 0 {
+		r.Concurrency = base.Concurrency
+	}
+	if !r.Rate.IsSet() {
+		r.Rate = base.Rate
+	}
+	if r.Duration.Duration == 0 {
+		r.Duration = base.Duration
+	}
+	if r.Stages == nil {
+		r.Stages = base.Stages
+	}
+	if r.RespType == "" {
+		r.RespType = base.RespType
+	}
+	if !r.FwdCookies {
+		r.FwdCookies = base.FwdCookies
+	}
+	if r.SpawnChildren == "" {
+		r.SpawnChildren = base.SpawnChildren
+	}
+	if r.Weight == 0 {
+		r.Weight = base.Weight
+	}
+	if r.URL == nil {
+		r.URL = base.URL
+	}
+	if r.Headers == nil {
+		r.Headers = base.Headers
+	}
+	if r.Data == nil {
+		r.Data = base.Data
+	}
+	if r.Assert == nil {
+		r.Assert = base.Assert
+	}
+	r.SLOs = append(base.SLOs, r.SLOs...)
+	r.Children = append(base.Children, r.Children...)
+	return nil
+}
+
+// clone returns a copy of the definition of the request and of its children, without their state, so that
+// each request using a template is run and reported on its own.
+func (r *Request) clone() *Request {
+	c := &Request{Method: r.Method, Use: r.Use, Repeat: r.Repeat, Concurrency: r.Concurrency, Rate: r.Rate,
+		Duration: r.Duration, Stages: r.Stages, RespType: r.RespType, FwdCookies: r.FwdCookies,
+		SpawnChildren: r.SpawnChildren, Weight: r.Weight, URL: r.URL, Headers: r.Headers, Data: r.Data, Assert: r.Assert}
+	for _, slo := range r.SLOs {
+		copied := *slo // Objectives store their evaluation.
+		c.SLOs = append(c.SLOs, &copied)
+	}
+	for _, child := range r.Children {
+		c.Children = append(c.Children, child.clone())
+	}
+	return c
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCompose(t *testing.T) {
+	Convey("Testing the composition of profiles", t, func() {
+		defer func(overrides variableFlags) { variableOverrides = overrides }(variableOverrides)
+		defer func(figures int, percentiles []float64) {
+			significantFigures, reportedPercentiles = figures, percentiles
+		}(significantFigures, reportedPercentiles)
+		variableOverrides = variableFlags{}
+		dir, _ := ioutil.TempDir("", "sg")
+		defer os.RemoveAll(dir)
+		os.Mkdir(filepath.Join(dir, "common"), 0755)
+		ioutil.WriteFile(filepath.Join(dir, "common", "auth.xml"), []byte(`<sg>
+	<include file="setup.yaml" />
+	<template name="login" method="post" repeat="1" concurrency="1" responseType="json">
+		<url base="${HOST}/login" />
+		<data>{"username": "admin"}</data>
+		<slo>p95 &lt; 300ms</slo>
+		<request method="get" repeat="1" concurrency="1">
+			<url base="${HOST}/me" />
+		</request>
+	</template>
+</sg>`), 0644)
+		ioutil.WriteFile(filepath.Join(dir, "common", "setup.yaml"), []byte(`templates:
+- name: items
+  use: login
+  requests:
+  - method: get
+    repeat: 1
+    concurrency: 1
+    url:
+      base: ${HOST}/items
+tests:
+- name: Setup
+  requests:
+  - use: login
+`), 0644)
+		profileFile := filepath.Join(dir, "profile.xml")
+		ioutil.WriteFile(profileFile, []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<sg name="Composed" uid="composed-1">
+	<include file="common/auth.xml" />
+	<variables>
+		<var name="HOST" default="http://example.org" />
+	</variables>
+	<test name="Login" critical="1s" warning="750ms">
+		<request use="login" repeat="10" concurrency="2">
+			<request method="get" repeat="1" concurrency="1">
+				<url base="http://example.org/logout" />
+			</request>
+		</request>
+		<request use="items">
+			<url base="http://example.org/sso" />
+		</request>
+	</test>
+</sg>`), 0644)
+
+		Convey("Included tests come first, and requests take the fields they do not define from their template", func() {
+			p, err := readProfile(profileFile)
+			So(err, ShouldBeNil)
+			So(len(p.Tests), ShouldEqual, 2)
+			So(p.Tests[0].Name, ShouldEqual, "Setup")
+			So(p.Tests[0].Requests[0].URL.Base, ShouldEqual, "http://example.org/login")
+
+			login := p.Tests[1].Requests[0]
+			So(login.Use, ShouldEqual, "")
+			So(login.Method, ShouldEqual, "POST")
+			So(login.Repeat, ShouldEqual, 10)
+			So(login.Concurrency, ShouldEqual, 2)
+			So(login.RespType, ShouldEqual, "json")
+			So(login.Data.Data, ShouldEqual, `{"username": "admin"}`)
+			So(len(login.SLOs), ShouldEqual, 1)
+			So(len(login.Children), ShouldEqual, 2)
+			So(login.Children[0].URL.Base, ShouldEqual, "http://example.org/me")
+			So(login.Children[0].Parent, ShouldEqual, login)
+			So(login.Children[1].URL.Base, ShouldEqual, "http://example.org/logout")
+
+			items := p.Tests[1].Requests[1]
+			So(items.URL.Base, ShouldEqual, "http://example.org/sso")
+			So(items.Repeat, ShouldEqual, 1)
+			So(len(items.Children), ShouldEqual, 2)
+			So(items.Children[1].URL.Base, ShouldEqual, "http://example.org/items")
+
+			Convey("and each request runs its own copy of the children of the template", func() {
+				So(items.Children[0], ShouldNotPointTo, login.Children[0])
+				So(items.SLOs[0], ShouldNotPointTo, login.SLOs[0])
+				So(p.Tests[0].Requests[0].Children[0], ShouldNotPointTo, login.Children[0])
+			})
+		})
+
+		Convey("Templates of the profile override the included ones", func() {
+			p := &Profile{Templates: []*Template{{Name: "login", Request: Request{Method: "get"}}, {Name: "login", Request: Request{Method: "put"}}},
+				Tests: []*StressTest{{Name: "T", Requests: []*Request{{Use: "login"}}}}}
+			So(p.applyTemplates(), ShouldBeNil)
+			So(p.Tests[0].Requests[0].Method, ShouldEqual, "put")
+		})
+
+		Convey("Unknown and recursive templates are reported", func() {
+			p := &Profile{Templates: []*Template{{Name: "loop", Request: Request{Use: "loop"}}, {}},
+				Tests: []*StressTest{{Name: "T", Requests: []*Request{{Use: "loop"}, {Method: "get", Children: []*Request{{Use: "missing"}}}}}}}
+			err := p.applyTemplates()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "template[2]: template name not defined\n"+
+				"test \"T\" > request[1]: template `loop` uses itself\n"+
+				"test \"T\" > request[2] > request[1]: unknown template `missing`")
+		})
+
+		Convey("Missing and recursive includes are reported", func() {
+			ioutil.WriteFile(filepath.Join(dir, "common", "loop.xml"), []byte(`<sg><include file="../loop.xml" /></sg>`), 0644)
+			loop := filepath.Join(dir, "loop.xml")
+			ioutil.WriteFile(loop, []byte(`<sg name="Loop">
+	<include file="common/loop.xml" />
+	<include file="missing.xml" />
+</sg>`), 0644)
+			_, err := readProfile(loop)
+			So(err, ShouldNotBeNil)
+			errs := err.(ValidationErrors)
+			So(len(errs), ShouldEqual, 2)
+			So(errs[0].Path, ShouldEqual, `include "common/loop.xml" > include "../loop.xml"`)
+			So(errs[0].Message, ShouldEqual, "../loop.xml is already being included")
+			So(errs[1].Path, ShouldEqual, `include "missing.xml"`)
+			So(errs[1].Message, ShouldContainSubstring, "no such file")
+		})
+
+		Convey("Problems of included fragments are located in the fragment", func() {
+			ioutil.WriteFile(filepath.Join(dir, "broken.xml"), []byte("<sg>\n\t<template name=\"${TYPO}\" />\n</sg>"), 0644)
+			ioutil.WriteFile(profileFile, []byte(`<sg name="Broken"><include file="broken.xml" /></sg>`), 0644)
+			_, err := readProfile(profileFile)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, `line 2, column 18: include "broken.xml": variable TYPO is not declared`)
+		})
+	})
+}
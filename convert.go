@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// profileFormat returns the format of a profile file from its extension: json, yaml, or xml by default.
+func profileFormat(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+	return "xml"
+}
+
+// decodeProfile decodes a profile in the provided format, without validating it. Unknown
+// fields of JSON and YAML profiles are errors, so that typos are not silently ignored.
+func decodeProfile(data []byte, format string) (*Profile, error) {
+	p := &Profile{}
+	switch format {
+	case "json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(p); err != nil {
+			e := &ValidationError{Message: err.Error()}
+			offset := int64(-1)
+			switch err := err.(type) {
+			case *json.SyntaxError:
+				offset = err.Offset
+			case *json.UnmarshalTypeError:
+				offset = err.Offset
+			}
+			if offset >= 0 && offset <= int64(len(data)) {
+				e.Line, e.Column = offsetPosition(data, int(offset))
+			}
+			return nil, ValidationErrors{e}
+		}
+	case "yaml":
+		if err := yaml.UnmarshalStrict(data, p); err != nil {
+			return nil, ValidationErrors{{Message: err.Error()}}
+		}
+	default:
+		if err := xml.Unmarshal(data, p); err != nil {
+			if syntax, ok := err.(*xml.SyntaxError); ok {
+				return nil, ValidationErrors{{Line: syntax.Line, Message: syntax.Msg}}
+			}
+			return nil, ValidationErrors{{Message: err.Error()}}
+		}
+	}
+	return p, nil
+}
+
+// encodeProfile encodes a profile in the provided format.
+func encodeProfile(p *Profile, format string) ([]byte, error) {
+	switch format {
+	case "json":
+		content, err := json.MarshalIndent(p, "", "\t")
+		return append(content, '\n'), err
+	case "yaml":
+		return yaml.Marshal(p)
+	}
+	content := &bytes.Buffer{}
+	content.WriteString(xml.Header)
+	encoder := xml.NewEncoder(content)
+	encoder.Indent("", "\t")
+	if err := encoder.EncodeElement(p, xml.StartElement{Name: xml.Name{Local: "sg"}}); err != nil {
+		return nil, err
+	}
+	content.WriteString("\n")
+	return content.Bytes(), nil
+}
+
+// convertCommand implements `sg convert in.xml out.yaml`, which translates a profile between the XML,
+// JSON and YAML formats, chosen by the file extensions. The references to variables are kept, see markVariables.
+// It returns the exit code.
+func convertCommand(args []string, out io.Writer) int {
+	if len(args) != 2 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(out, "usage: sg convert in.xml|in.json|in.yaml out.xml|out.json|out.yaml")
+		return 2
+	}
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+	data, references, err := markVariables(data, profileFormat(args[0]), variableOverrides)
+	var p *Profile
+	if err == nil {
+		p, err = decodeProfile(data, profileFormat(args[0]))
+	}
+	if err != nil {
+		fmt.Fprintf(out, "could not convert %s:\n%s\n", args[0], err)
+		return 2
+	}
+	content, err := encodeProfile(p, profileFormat(args[1]))
+	if err == nil {
+		err = ioutil.WriteFile(args[1], restoreVariables(content, references), 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(out, "could not convert %s: %s\n", args[0], err)
+		return 2
+	}
+	fmt.Fprintf(out, "Converted %s to %s.\n", args[0], args[1])
+	return 0
+}
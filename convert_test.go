@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConvert(t *testing.T) {
+	Convey("Testing the JSON and YAML profiles", t, func() {
+		defer func(figures int, percentiles []float64, interval time.Duration) {
+			significantFigures, reportedPercentiles, bucketInterval = figures, percentiles, interval
+		}(significantFigures, reportedPercentiles, bucketInterval)
+		dir, _ := ioutil.TempDir("", "sg")
+		defer os.RemoveAll(dir)
+		data, _ := ioutil.ReadFile("docs/examples/basic.xml")
+		original, err := decodeProfile(data, "xml")
+		So(err, ShouldBeNil)
+
+		Convey("The format is chosen by the file extension", func() {
+			So(profileFormat("profile.xml"), ShouldEqual, "xml")
+			So(profileFormat("profile.json"), ShouldEqual, "json")
+			So(profileFormat("profile.YAML"), ShouldEqual, "yaml")
+			So(profileFormat("profile.yml"), ShouldEqual, "yaml")
+			So(profileFormat("profile"), ShouldEqual, "xml")
+		})
+
+		Convey("Profiles are converted between the three formats without loss", func() {
+			for _, format := range []string{"yaml", "json", "xml"} {
+				content, err := encodeProfile(original, format)
+				So(err, ShouldBeNil)
+				converted, err := decodeProfile(content, format)
+				So(err, ShouldBeNil)
+				So(converted, ShouldResemble, original)
+			}
+			content, _ := encodeProfile(original, "xml")
+			So(string(content), ShouldStartWith, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+`<sg name="Basic example"`)
+			So(string(content), ShouldNotContainSubstring, `="0s"`)
+			So(string(content), ShouldNotContainSubstring, "<stages></stages>")
+			original.Tests[0].Requests[0].Data = &Tokenized{Data: `<wait timeout="0s"></wait>`}
+			content, _ = encodeProfile(original, "xml")
+			So(string(content), ShouldContainSubstring, `<data><wait timeout="0s"></wait></data>`)
+			content, _ = encodeProfile(original, "yaml")
+			So(string(content), ShouldContainSubstring, "\n  slos:\n  - throughput > 10rps\n")
+			So(string(content), ShouldContainSubstring, "    rate: 200/s\n    duration: 30s\n")
+		})
+
+		Convey("YAML and JSON profiles are loaded and validated", func() {
+			yamlFile := filepath.Join(dir, "profile.yaml")
+			ioutil.WriteFile(yamlFile, []byte(`name: YAML example
+uid: yaml-1
+tests:
+- name: Login
+  critical: 1s
+  warning: 750ms
+  requests:
+  - method: post
+    repeat: 10
+    concurrency: 2
+    url:
+      base: http://example.org/login
+    slos:
+    - p95 < 300ms
+    requests:
+    - method: get
+      rate: 20/s
+      duration: 10s
+      url:
+        base: http://example.org/items/{id}
+        tokens:
+        - token: "{id}"
+          pattern: num
+          min: 1
+          max: 100
+`), 0644)
+			So(loadProfile(yamlFile), ShouldBeNil)
+			So(profile.UID, ShouldEqual, "yaml-1")
+			login := profile.Tests[0].Requests[0]
+			So(login.Method, ShouldEqual, "POST")
+			So(login.SLOs[0].Rule, ShouldEqual, "p95 < 300ms")
+			So(login.Children[0].Parent, ShouldEqual, login)
+			So(login.Children[0].Repeat, ShouldEqual, 200)
+			So(login.Children[0].URL.String(), ShouldEqual, "http://example.org/items/[0-9]{1,3}")
+
+			jsonFile := filepath.Join(dir, "profile.json")
+			So(convertCommand([]string{yamlFile, jsonFile}, &bytes.Buffer{}), ShouldEqual, 0)
+			So(loadProfile(jsonFile), ShouldBeNil)
+			So(profile.Tests[0].Requests[0].Children[0].Rate.String(), ShouldEqual, "20/s")
+		})
+
+		Convey("Problems of YAML and JSON profiles are reported", func() {
+			typo := filepath.Join(dir, "typo.yaml")
+			ioutil.WriteFile(typo, []byte("name: Typo\ntests:\n- name: Login\n  requests:\n  - method: get\n    concurency: 2\n"), 0644)
+			_, err := readProfile(typo)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "line 6: field concurency not found")
+
+			invalid := filepath.Join(dir, "invalid.json")
+			ioutil.WriteFile(invalid, []byte(`{"name": "Invalid", "tests": [{"name": "Login", "requests": [{"url": {"base": "http://example.org/"}}]}]}`), 0644)
+			_, err = readProfile(invalid)
+			So(err, ShouldNotBeNil)
+			So(err.(ValidationErrors)[0].Path, ShouldEqual, `test "Login" > request[1]`)
+			So(err.(ValidationErrors)[0].Message, ShouldEqual, "method not defined")
+
+			broken := filepath.Join(dir, "broken.json")
+			ioutil.WriteFile(broken, []byte("{\n\t\"name\": \"Broken\",\n\t\"tests\": [}\n"), 0644)
+			_, err = readProfile(broken)
+			So(err, ShouldNotBeNil)
+			So(err.(ValidationErrors)[0].Line, ShouldEqual, 3)
+		})
+
+		Convey("sg convert writes the profile in the format of the output file", func() {
+			out := &bytes.Buffer{}
+			yamlFile := filepath.Join(dir, "basic.yml")
+			So(convertCommand([]string{"docs/examples/basic.xml", yamlFile}, out), ShouldEqual, 0)
+			So(out.String(), ShouldEqual, "Converted docs/examples/basic.xml to "+yamlFile+".\n")
+			content, _ := ioutil.ReadFile(yamlFile)
+			So(strings.HasPrefix(string(content), "name: Basic example\n"), ShouldBeTrue)
+
+			So(convertCommand([]string{"docs/examples/basic.xml"}, out), ShouldEqual, 2)
+			So(convertCommand([]string{filepath.Join(dir, "missing.xml"), yamlFile}, out), ShouldEqual, 2)
+			ioutil.WriteFile(filepath.Join(dir, "broken.yaml"), []byte("name: [\n"), 0644)
+			So(convertCommand([]string{filepath.Join(dir, "broken.yaml"), yamlFile}, out), ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/op/go-logging"
+)
+
+// dashboardRefresh is the interval at which the dashboard is redrawn.
+const dashboardRefresh = time.Millisecond * 500
+
+// dashboardWindow is the span of the rolling rate and percentiles shown on the dashboard.
+const dashboardWindow = time.Second * 5
+
+// dashboardLogLines is the number of latest log messages shown below the requests.
+const dashboardLogLines = 5
+
+// dashboardBarWidth is the number of characters of each progress bar.
+const dashboardBarWidth = 30
+
+// Dashboard continuously renders the progress of the ongoing test to a terminal. While it runs,
+// it is also the logging backend so that log messages do not scroll the dashboard away.
+type Dashboard struct {
+	out      io.Writer
+	mutex    sync.Mutex
+	test     *StressTest
+	requests []*Request // Requests of the ongoing test, including children and mix entries.
+	started  time.Time  // Start time of the ongoing test.
+	logs     []string   // Latest log messages.
+	previous logging.LeveledBackend
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// newDashboard returns a dashboard which renders to the provided writer.
+func newDashboard(out io.Writer) *Dashboard {
+	return &Dashboard{out: out}
+}
+
+// Start takes over the logging backend and starts redrawing the dashboard.
+func (d *Dashboard) Start() {
+	d.previous = logging.SetBackend(d)
+	d.stop = make(chan struct{})
+	d.stopped = make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(dashboardRefresh)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				d.draw()
+			case <-d.stop:
+				d.draw()
+				close(d.stopped)
+				return
+			}
+		}
+	}()
+}
+
+// Stop draws the dashboard a last time and restores the previous logging backend.
+func (d *Dashboard) Stop() {
+	close(d.stop)
+	<-d.stopped
+	logging.SetBackend(d.previous)
+}
+
+// Watch sets the test whose requests are displayed. It must be called before the test starts
+// because the children of a request are unset once they were spawned.
+func (d *Dashboard) Watch(test *StressTest) {
+	requests := []*Request{}
+	var visit func(children []*Request)
+	visit = func(children []*Request) {
+		for _, r := range children {
+			requests = append(requests, r)
+			visit(r.Children)
+		}
+	}
+	visit(test.Requests)
+	if test.Mix != nil {
+		requests = append(requests, test.Mix.Requests...)
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.test = test
+	d.requests = requests
+	d.started = time.Now()
+}
+
+// Log implements the logging.Backend interface by keeping the latest messages.
+func (d *Dashboard) Log(level logging.Level, calldepth int, rec *logging.Record) error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.logs = append(d.logs, fmt.Sprintf("%s %s %s", rec.Time.Format("15:04:05.000"), level, rec.Message()))
+	if len(d.logs) > dashboardLogLines {
+		d.logs = d.logs[len(d.logs)-dashboardLogLines:]
+	}
+	return nil
+}
+
+// draw clears the terminal and renders the dashboard.
+func (d *Dashboard) draw() {
+	content := d.render(time.Now())
+	io.WriteString(d.out, "\033[H\033[2J"+content)
+}
+
+// render returns the dashboard as of the provided time. The progress of the requests is taken
+// without holding the lock of the dashboard, since logging takes that lock.
+func (d *Dashboard) render(now time.Time) string {
+	d.mutex.Lock()
+	test, requests, started := d.test, d.requests, d.started
+	d.mutex.Unlock()
+	var buf bytes.Buffer
+	if test == nil {
+		buf.WriteString("Waiting for the first test to start...\n")
+	} else {
+		fmt.Fprintf(&buf, "Test %s - elapsed %s\n\n", test.Name, now.Sub(started).Round(time.Second))
+		for _, r := range requests {
+			if p := r.progress(now); p != nil {
+				buf.WriteString(p.String())
+			}
+		}
+	}
+	d.mutex.Lock()
+	logs := append([]string{}, d.logs...)
+	d.mutex.Unlock()
+	if len(logs) > 0 {
+		buf.WriteString("\nLatest messages:\n")
+		for _, line := range logs {
+			fmt.Fprintf(&buf, "  %s\n", line)
+		}
+	}
+	return buf.String()
+}
+
+// requestProgress is a snapshot of the progress of a request, as displayed on the dashboard.
+type requestProgress struct {
+	label    string
+	done     int
+	expected int     // Number of requests to send, or 0 if not known in advance.
+	fraction float64 // Progress from 0 to 1, or -1 if unknown.
+	inFlight int
+	rate     float64 // Responses per second over the rolling window.
+	window   *Percentages
+	statuses []Status
+	errored  int // Requests which got no response.
+}
+
+// progress returns a snapshot of the progress of this request, or nil if it has not started yet.
+func (r *Request) progress(now time.Time) *requestProgress {
+	r.aggMutex.Lock()
+	defer r.aggMutex.Unlock()
+	runs := int(atomic.LoadInt32(&r.runs))
+	if runs == 0 && r.agg.count == 0 {
+		return nil
+	}
+	p := &requestProgress{label: fmt.Sprintf("%s %s", r.Method, r.URL), done: r.agg.count, expected: r.Repeat * runs,
+		fraction: -1, inFlight: int(atomic.LoadInt32(&r.inFlight)), window: newPercentages(bucketFigures), statuses: r.agg.Statuses(),
+		errored: r.agg.summary.None}
+	if p.expected > 0 {
+		p.fraction = math.Min(1, float64(p.done)/float64(p.expected))
+	} else if r.isTimed() && !r.agg.first.IsZero() {
+		var total time.Duration
+		for _, stage := range r.loadStages() {
+			total += stage.Duration.Duration
+		}
+		p.fraction = math.Min(1, float64(now.Sub(r.agg.first))/float64(total))
+	}
+	if s := r.agg.series; s != nil && !s.origin.IsZero() {
+		since := now.Add(-dashboardWindow)
+		var requests int
+		var from time.Time
+		for _, bucket := range s.Buckets {
+			start := s.origin.Add(bucket.Offset.Duration)
+			if start.Add(s.Interval.Duration).Before(since) {
+				continue
+			}
+			if from.IsZero() {
+				from = start
+			}
+			requests += bucket.Requests
+			p.window.Merge(bucket.Times)
+		}
+		if !from.IsZero() && now.After(from) {
+			p.rate = float64(requests) / now.Sub(from).Seconds()
+		}
+	}
+	return p
+}
+
+// String renders the progress bar, rolling statistics and status codes of the request.
+func (p *requestProgress) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s\n  ", p.label)
+	if p.fraction >= 0 {
+		filled := int(p.fraction * dashboardBarWidth)
+		fmt.Fprintf(&buf, "[%s%s] %5.1f%%  ", strings.Repeat("#", filled), strings.Repeat(".", dashboardBarWidth-filled), p.fraction*100)
+	}
+	if p.expected > 0 {
+		fmt.Fprintf(&buf, "%d/%d done", p.done, p.expected)
+	} else {
+		fmt.Fprintf(&buf, "%d done", p.done)
+	}
+	fmt.Fprintf(&buf, ", %d in flight, %.1f rps\n", p.inFlight, p.rate)
+	fmt.Fprintf(&buf, "  last %s: p50 %s, p95 %s, p99 %s\n", dashboardWindow, p.window.Quantile(50).Duration.Round(time.Microsecond),
+		p.window.Quantile(95).Duration.Round(time.Microsecond), p.window.Quantile(99).Duration.Round(time.Microsecond))
+	sort.Slice(p.statuses, func(i, j int) bool { return p.statuses[i].Code < p.statuses[j].Code })
+	codes := []string{}
+	for _, status := range p.statuses {
+		codes = append(codes, fmt.Sprintf("%d: %d", status.Code, status.Count))
+	}
+	if p.errored > 0 {
+		codes = append(codes, fmt.Sprintf("errored: %d", p.errored))
+	}
+	if len(codes) > 0 {
+		fmt.Fprintf(&buf, "  statuses %s\n", strings.Join(codes, ", "))
+	}
+	return buf.String()
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/op/go-logging"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDashboard(t *testing.T) {
+	Convey("Testing the live dashboard", t, func() {
+		child := &Request{Method: "get", Repeat: 1, Concurrency: 1, URL: &URL{Base: "http://example.org/child"}}
+		r := &Request{Method: "get", Repeat: 100, Concurrency: 10, URL: &URL{Base: "http://example.org/"}, Children: []*Request{child}}
+		r.Validate()
+		child.Validate()
+		test := &StressTest{Name: "Dashboard test", Requests: []*Request{r}}
+		d := newDashboard(&bytes.Buffer{})
+		So(d.render(time.Now()), ShouldContainSubstring, "Waiting for the first test")
+		d.Watch(test)
+		So(d.requests, ShouldResemble, []*Request{r, child})
+
+		Convey("Requests which have not started are not shown", func() {
+			So(d.render(time.Now()), ShouldNotContainSubstring, "http://example.org/")
+		})
+
+		Convey("The progress and rolling statistics are shown", func() {
+			now := time.Now()
+			r.runs = 1
+			for i := 0; i < 50; i++ {
+				status := 200
+				if i%10 == 0 {
+					status = 503
+				}
+				r.agg.add(&Response{statusCode: status, started: now.Add(-time.Second * 2), duration: time.Millisecond * 10})
+			}
+			r.agg.add(&Response{statusCode: -1, started: now.Add(-time.Second)})
+			r.inFlight = 1
+			content := d.render(now)
+			So(content, ShouldStartWith, "Test Dashboard test - elapsed ")
+			So(content, ShouldContainSubstring, "GET http://example.org/\n")
+			So(content, ShouldContainSubstring, "[###############...............]  51.0%  51/100 done, 1 in flight, ")
+			So(content, ShouldContainSubstring, "last 5s: p50 10")
+			So(content, ShouldContainSubstring, "statuses 200: 45, 503: 5, errored: 1\n")
+			So(content, ShouldNotContainSubstring, "example.org/child")
+
+			// Past the rolling window, the latest statistics are empty.
+			So(d.render(now.Add(time.Minute)), ShouldContainSubstring, "0.0 rps\n  last 5s: p50 0s, p95 0s, p99 0s")
+		})
+
+		Convey("Logging does not wait for the statistics being rendered", func() {
+			r.runs = 1
+			r.aggMutex.Lock()
+			rendered := make(chan string)
+			go func() { rendered <- d.render(time.Now()) }()
+			logged := make(chan struct{})
+			go func() {
+				d.Log(logging.WARNING, 0, &logging.Record{Time: time.Now(), Level: logging.WARNING, Args: []interface{}{}})
+				close(logged)
+			}()
+			select {
+			case <-logged:
+			case <-time.After(time.Second):
+				t.Fatal("logging blocked while rendering")
+			}
+			r.aggMutex.Unlock()
+			So(<-rendered, ShouldContainSubstring, "GET http://example.org/\n")
+		})
+
+		Convey("Timed requests show their progress over their duration", func() {
+			timed := &Request{Method: "get", Concurrency: 1, Duration: Duration{Duration: time.Second * 10}, URL: &URL{Base: "http://example.org/timed"}}
+			timed.Validate()
+			now := time.Now()
+			timed.runs = 1
+			timed.agg.add(&Response{statusCode: 200, started: now.Add(-time.Second * 5), duration: time.Millisecond})
+			So(timed.progress(now).String(), ShouldContainSubstring, " 50.0%  1 done")
+		})
+
+		Convey("Only the latest log messages are kept", func() {
+			for i := 0; i < dashboardLogLines+2; i++ {
+				d.Log(logging.NOTICE, 0, &logging.Record{Time: time.Now(), Level: logging.NOTICE, Args: []interface{}{i}})
+			}
+			So(len(d.logs), ShouldEqual, dashboardLogLines)
+			So(d.logs[0], ShouldEndWith, "NOTICE 2")
+		})
+
+		Convey("The dashboard is the logging backend while it runs", func() {
+			out := &bytes.Buffer{}
+			d := newDashboard(out)
+			d.Start()
+			log.Notice("Hello dashboard.")
+			d.Stop()
+			So(strings.Count(out.String(), "\033[H\033[2J"), ShouldBeGreaterThanOrEqualTo, 1)
+			So(out.String(), ShouldContainSubstring, "NOTICE Hello dashboard.")
+		})
+	})
+}
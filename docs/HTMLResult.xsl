@@ -63,6 +63,34 @@
 					</span>
 					.
 				</p>
+				<xsl:call-template name="slos" />
+				<xsl:if test="scenario">
+					<p class="text-info row">
+						<xsl:value-of
+							select="concat(scenario/@users, ' virtual user(s) completed ', scenario/result/@iterations, ' iteration(s) of the scenario.')" />
+					</p>
+					<h5>Iteration durations</h5>
+					<div class="row">
+						<p class="col-md-10">
+							<table class="table">
+								<tr>
+									<xsl:for-each select="scenario/result/times/*">
+										<th class="text-center">
+											<xsl:value-of select="local-name()" />
+										</th>
+									</xsl:for-each>
+								</tr>
+								<tr>
+									<xsl:for-each select="scenario/result/times/*">
+										<td class="text-center">
+											<xsl:value-of select="@duration" />
+										</td>
+									</xsl:for-each>
+								</tr>
+							</table>
+						</p>
+					</div>
+				</xsl:if>
 				<!-- Generating a table of contents. -->
 				<ul>
 					<xsl:apply-templates select="result" mode="toc" />
@@ -72,6 +100,43 @@
 			<xsl:apply-templates select="result" mode="detail" />
 		</div>
 	</xsl:template>
+	<xsl:template name="slos">
+		<xsl:if test="slo">
+			<h5>Service level objectives</h5>
+			<div class="row">
+				<p class="col-md-10">
+					<table class="table">
+						<tr>
+							<th class="text-center">Objective</th>
+							<th class="text-center">Actual</th>
+							<th class="text-center">Status</th>
+						</tr>
+						<xsl:for-each select="slo">
+							<tr>
+								<xsl:choose>
+									<xsl:when test="@status='passed'">
+										<xsl:attribute name="class">bg-success</xsl:attribute>
+									</xsl:when>
+									<xsl:otherwise>
+										<xsl:attribute name="class">bg-danger</xsl:attribute>
+									</xsl:otherwise>
+								</xsl:choose>
+								<td class="text-center">
+									<xsl:value-of select="." />
+								</td>
+								<td class="text-center">
+									<xsl:value-of select="@actual" />
+								</td>
+								<td class="text-center">
+									<xsl:value-of select="@status" />
+								</td>
+							</tr>
+						</xsl:for-each>
+					</table>
+				</p>
+			</div>
+		</xsl:if>
+	</xsl:template>
 	<xsl:template match="result|spawned" mode="toc">
 		<li>
 			<a>
@@ -110,9 +175,28 @@
 
 			</xsl:element>
 			<p class="text-info">
-				<xsl:value-of
-					select="concat(@concurrency, ' concurrent requests repeated ', @repetitions, ' time(s)')" />
+				<xsl:choose>
+					<xsl:when test="@intendedRate">
+						<xsl:value-of
+							select="concat(@repetitions, ' requests at ', format-number(@intendedRate, '0.##'), ' req/s (achieved ', format-number(@achievedRate, '0.##'), ' req/s)')" />
+					</xsl:when>
+					<xsl:when test="@weight">
+						<xsl:value-of
+							select="concat(@repetitions, ' requests (weight ', @weight, ') sent by a mix of ', @concurrency, ' concurrent requests')" />
+					</xsl:when>
+					<xsl:when test="@duration">
+						<xsl:value-of
+							select="concat(@repetitions, ' requests sent by ', @concurrency, ' concurrent requests over ', @duration)" />
+					</xsl:when>
+					<xsl:otherwise>
+						<xsl:value-of
+							select="concat(@concurrency, ' concurrent requests repeated ', @repetitions, ' time(s)')" />
+					</xsl:otherwise>
+				</xsl:choose>
 
+				<xsl:if test="@spawns">
+					<xsl:value-of select="concat(' for each of the ', @spawns, ' parent responses')" />
+				</xsl:if>
 				<xsl:if test="@withCookies='true'">
 					with cookies
 				</xsl:if>
@@ -123,6 +207,7 @@
 					with request body
 				</xsl:if>
 			</p>
+			<xsl:call-template name="slos" />
 			<h5>Status summary</h5>
 			<div class="row">
 				<p class="col-md-10">
@@ -168,7 +253,52 @@
 					</table>
 				</p>
 			</div>
-			<h5>Response times</h5>
+			<xsl:if test="assertions">
+				<h5>Assertions</h5>
+				<div class="row">
+					<p class="col-md-10">
+						<xsl:choose>
+							<xsl:when test="assertions/@failed>0">
+								<xsl:attribute name="class">col-md-10 text-danger</xsl:attribute>
+							</xsl:when>
+							<xsl:otherwise>
+								<xsl:attribute name="class">col-md-10 text-success</xsl:attribute>
+							</xsl:otherwise>
+						</xsl:choose>
+						<xsl:value-of
+							select="concat(assertions/@passed, ' response(s) passed and ', assertions/@failed, ' response(s) failed the assertions.')" />
+					</p>
+				</div>
+				<xsl:if test="assertions/failure">
+					<div class="row">
+						<p class="col-md-10">
+							<table class="table">
+								<tr>
+									<th class="text-center">Check</th>
+									<th class="text-center">Failures</th>
+									<th class="text-center">Sample</th>
+								</tr>
+								<xsl:for-each select="assertions/failure">
+									<tr>
+										<td class="text-center">
+											<xsl:value-of select="@check" />
+										</td>
+										<td class="text-danger text-center">
+											<xsl:value-of select="@count" />
+										</td>
+										<td class="text-center">
+											<xsl:value-of select="@sample" />
+										</td>
+									</tr>
+								</xsl:for-each>
+							</table>
+						</p>
+					</div>
+				</xsl:if>
+			</xsl:if>
+			<h5>
+				<xsl:value-of select="concat('Response times (', times/@count, ' samples)')" />
+			</h5>
 			<div class="row">
 				<p class="col-md-6">
 					<table class="table">
@@ -253,6 +383,101 @@
 					</table>
 				</p>
 			</div>
+			<xsl:if test="timeseries/bucket">
+				<h5>
+					<xsl:value-of select="concat('Time series (', timeseries/@interval, ' buckets)')" />
+				</h5>
+				<div class="row">
+					<p class="col-md-10">
+						<table class="table table-hover">
+							<tr>
+								<th class="text-center">Offset</th>
+								<th class="text-center">Requests</th>
+								<th class="text-center">Errors</th>
+								<th class="text-center">mean</th>
+								<xsl:for-each select="timeseries/bucket[1]/times/*[starts-with(local-name(), 'p')]">
+									<th class="text-center">
+										<xsl:value-of select="local-name()" />
+									</th>
+								</xsl:for-each>
+								<th class="text-center">longest</th>
+							</tr>
+							<xsl:for-each select="timeseries/bucket">
+								<tr>
+									<td class="text-center">
+										<xsl:choose>
+											<xsl:when test="@offset">
+												<xsl:value-of select="@offset" />
+											</xsl:when>
+											<xsl:otherwise>0s</xsl:otherwise>
+										</xsl:choose>
+									</td>
+									<td class="text-info text-center">
+										<xsl:value-of select="@requests" />
+									</td>
+									<td>
+										<xsl:choose>
+											<xsl:when test="@errors>0">
+												<xsl:attribute name="class">text-danger text-center</xsl:attribute>
+											</xsl:when>
+											<xsl:otherwise>
+												<xsl:attribute name="class">text-success text-center</xsl:attribute>
+											</xsl:otherwise>
+										</xsl:choose>
+										<xsl:value-of select="@errors" />
+									</td>
+									<xsl:for-each select="times/mean|times/*[starts-with(local-name(), 'p')]|times/longest">
+										<td>
+											<xsl:choose>
+												<xsl:when test="@state='nominal'">
+													<xsl:attribute name="class">bg-success text-center</xsl:attribute>
+												</xsl:when>
+												<xsl:when test="@state='warning'">
+													<xsl:attribute name="class">bg-warning text-center</xsl:attribute>
+												</xsl:when>
+												<xsl:when test="@state='critical'">
+													<xsl:attribute name="class">bg-danger text-center</xsl:attribute>
+												</xsl:when>
+												<xsl:otherwise>
+													<xsl:attribute name="class">text-center</xsl:attribute>
+												</xsl:otherwise>
+											</xsl:choose>
+											<xsl:value-of select="@duration" />
+										</td>
+									</xsl:for-each>
+								</tr>
+							</xsl:for-each>
+						</table>
+					</p>
+				</div>
+			</xsl:if>
+			<h5>Timing breakdown</h5>
+			<div class="row">
+				<p class="col-md-10">
+					<table class="table">
+						<tr>
+							<th class="text-center">Phase</th>
+							<xsl:for-each select="phases/ttfb/*">
+								<th class="text-center">
+									<xsl:value-of select="local-name()" />
+								</th>
+							</xsl:for-each>
+						</tr>
+						<xsl:for-each select="phases/*">
+							<tr>
+								<th class="text-center">
+									<xsl:value-of select="local-name()" />
+								</th>
+								<xsl:for-each select="*">
+									<td class="text-center">
+										<xsl:value-of select="@duration" />
+									</td>
+								</xsl:for-each>
+							</tr>
+						</xsl:for-each>
+					</table>
+				</p>
+			</div>
 			<h5>Status breakdown</h5>
 			<div class="row">
 				<p class="col-md-3">
@@ -278,6 +503,73 @@
 					</table>
 				</p>
 			</div>
+			<xsl:if test="stage">
+				<h5>Stages</h5>
+				<div class="row">
+					<p class="col-md-10">
+						<table class="table table-hover">
+							<thead>
+								<tr>
+									<th class="text-center">Stage</th>
+									<th class="text-center">Concurrency</th>
+									<th class="text-center">Requests</th>
+									<th class="text-center">Errored</th>
+									<th class="text-center">2xx</th>
+									<th class="text-center">4xx</th>
+									<th class="text-center">5xx</th>
+									<th class="text-center">Median</th>
+									<th class="text-center">p95</th>
+									<th class="text-center">p99</th>
+									<th class="text-center">Longest</th>
+								</tr>
+							</thead>
+							<tbody>
+								<xsl:for-each select="stage">
+									<tr>
+										<td class="text-center">
+											<xsl:value-of select="concat('#', position(), ' ', @mode, ' over ', @duration)" />
+										</td>
+										<td class="text-center">
+											<xsl:value-of select="@target" />
+										</td>
+										<td class="text-center">
+											<xsl:value-of select="@requests" />
+										</td>
+										<td class="text-center">
+											<xsl:value-of select="statuses/@errored" />
+										</td>
+										<td class="text-center">
+											<xsl:value-of select="statuses/@s2xx" />
+										</td>
+										<td class="text-center">
+											<xsl:value-of select="statuses/@s4xx" />
+										</td>
+										<td class="text-center">
+											<xsl:value-of select="statuses/@s5xx" />
+										</td>
+										<xsl:for-each select="times/p50|times/p95|times/p99|times/longest">
+											<td>
+												<xsl:choose>
+													<xsl:when test="@state='warning'">
+														<xsl:attribute name="class">bg-warning text-center</xsl:attribute>
+													</xsl:when>
+													<xsl:when test="@state='critical'">
+														<xsl:attribute name="class">bg-danger text-center</xsl:attribute>
+													</xsl:when>
+													<xsl:otherwise>
+														<xsl:attribute name="class">bg-success text-center</xsl:attribute>
+													</xsl:otherwise>
+												</xsl:choose>
+												<xsl:value-of select="@duration" />
+											</td>
+										</xsl:for-each>
+									</tr>
+								</xsl:for-each>
+							</tbody>
+						</table>
+					</p>
+				</div>
+			</xsl:if>
 			<xsl:apply-templates select="spawned" mode="detail" />
 		</div>
 	</xsl:template>
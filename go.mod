@@ -0,0 +1,21 @@
+module github.com/ChristopherRabotin/sg
+
+go 1.24
+
+require (
+	github.com/HdrHistogram/hdrhistogram-go v1.1.2
+	github.com/franela/goreq v0.0.0-20171204163338-bcd34c9993f8
+	github.com/jmcvetta/randutil v0.0.0-20150817122601-2bb1b664bcff
+	github.com/op/go-logging v0.0.0-20160315200505-970db520ece7
+	github.com/smartystreets/goconvey v1.8.1
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require (
+	github.com/franela/goblin v0.0.0-20210519012713-85d372ac71e2 // indirect
+	github.com/google/go-cmp v0.7.0 // indirect
+	github.com/gopherjs/gopherjs v1.17.2 // indirect
+	github.com/jtolds/gls v4.20.0+incompatible // indirect
+	github.com/onsi/gomega v1.36.2 // indirect
+	github.com/smarty/assertions v1.15.0 // indirect
+)
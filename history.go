@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// historyTimeFormat is the format of the timestamps of the runs stored in the history, to the millisecond.
+const historyTimeFormat = "20060102-150405.000"
+
+// historyInvalid matches the characters which are replaced in the directory names of the history.
+var historyInvalid = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// historyKey returns the directory of a profile in the history: its UID, or its name if it has none.
+func historyKey(profile *Profile) string {
+	key := profile.UID
+	if key == "" {
+		key = profile.Name
+	}
+	return historyInvalid.ReplaceAllString(key, "_")
+}
+
+// saveHistory stores the JSON result of the profile in the history, once its results were saved, and returns its filename.
+// A run never overwrites another: if one was stored at the same time, the timestamp is moved to the next millisecond.
+func saveHistory(profile *Profile, dir string, at time.Time) (string, error) {
+	profileDir := filepath.Join(dir, historyKey(profile))
+	if err := os.MkdirAll(profileDir, 0755); err != nil {
+		return "", err
+	}
+	content, err := json.MarshalIndent(newJSONProfile(profile), "", "\t")
+	if err != nil {
+		return "", err
+	}
+	for {
+		filename := filepath.Join(profileDir, at.Format(historyTimeFormat)+".json")
+		f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			at = at.Add(time.Millisecond)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = f.Write(content)
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		return filename, err
+	}
+}
+
+// historyRun is a past run of a profile.
+type historyRun struct {
+	At       time.Time
+	Filename string
+	Results  []*comparedResult
+}
+
+// loadHistory loads the runs stored in the provided directory of the history, oldest first.
+func loadHistory(profileDir string) ([]*historyRun, error) {
+	filenames, err := filepath.Glob(filepath.Join(profileDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	runs := []*historyRun{}
+	for _, filename := range filenames {
+		at, err := time.ParseInLocation(historyTimeFormat, strings.TrimSuffix(filepath.Base(filename), ".json"), time.Local)
+		if err != nil {
+			continue // Not a run stored by sg.
+		}
+		results, err := loadComparedResults(filename)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, &historyRun{At: at, Filename: filename, Results: results})
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].At.Before(runs[j].At) })
+	return runs, nil
+}
+
+// sparkTicks are the characters of the sparklines, from the lowest to the highest value.
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline returns the trend of the provided values, where negative values are missing.
+func sparkline(values []float64) string {
+	lowest, highest := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		if v >= 0 {
+			lowest = math.Min(lowest, v)
+			highest = math.Max(highest, v)
+		}
+	}
+	line := make([]rune, len(values))
+	for i, v := range values {
+		switch {
+		case v < 0:
+			line[i] = ' '
+		case highest == lowest:
+			line[i] = sparkTicks[0]
+		default:
+			line[i] = sparkTicks[int((v-lowest)/(highest-lowest)*float64(len(sparkTicks)-1)+0.5)]
+		}
+	}
+	return string(line)
+}
+
+// historyTrends are the metrics whose trend is shown for each result.
+var historyTrends = []string{"mean", "p95", "p99", "error rate"}
+
+// historyValue returns the value of the provided metric of a result, in milliseconds or in percent
+// for the error rate, or -1 if it was not reported.
+func historyValue(c *comparedResult, metric string) float64 {
+	if metric == "error rate" {
+		return c.ErrorRate()
+	}
+	for _, t := range c.Times {
+		if t.Name == metric {
+			return milliseconds(t.Duration)
+		}
+	}
+	return -1
+}
+
+// writeHistory writes the runs of a profile, and the trends of the mean, p95, p99 and error rate of each result.
+func writeHistory(runs []*historyRun, out io.Writer) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintf(w, "%d run(s):\n", len(runs))
+	for _, run := range runs {
+		fmt.Fprintf(w, "\t%s\t%s\t\n", run.At.Format("2006-01-02 15:04:05"), run.Filename)
+	}
+	fmt.Fprintln(w)
+	// Results are listed in the order of the latest run, followed by those which are no longer run.
+	keys := []string{}
+	byRun := make([]map[string]*comparedResult, len(runs))
+	for rno := len(runs) - 1; rno >= 0; rno-- {
+		byRun[rno] = map[string]*comparedResult{}
+		for i, key := range matchKeys(runs[rno].Results) {
+			if !contains(keys, key) {
+				keys = append(keys, key)
+			}
+			byRun[rno][key] = runs[rno].Results[i]
+		}
+	}
+	for _, key := range keys {
+		var title string
+		trends := map[string][]float64{}
+		for rno := range runs {
+			c, exists := byRun[rno][key]
+			if exists {
+				title = fmt.Sprintf("%s: %s", c.Test, c.Name)
+			}
+			for _, metric := range historyTrends {
+				value := -1.0
+				if exists {
+					value = historyValue(c, metric)
+				}
+				trends[metric] = append(trends[metric], value)
+			}
+		}
+		fmt.Fprintf(w, "%s\n\t\tfirst\tlatest\ttrend\t\n", title)
+		for _, metric := range historyTrends {
+			values := trends[metric]
+			first, latest := "-", "-"
+			for _, v := range values {
+				if v >= 0 {
+					first = formatHistoryValue(metric, v)
+					break
+				}
+			}
+			if v := values[len(values)-1]; v >= 0 {
+				latest = formatHistoryValue(metric, v)
+			}
+			fmt.Fprintf(w, "\t%s\t%s\t%s\t%s\t\n", metric, first, latest, sparkline(values))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// formatHistoryValue formats a value of the provided metric, in milliseconds or in percent for the error rate.
+func formatHistoryValue(metric string, v float64) string {
+	if metric == "error rate" {
+		return fmt.Sprintf("%.2f%%", v)
+	}
+	return formatMs(v)
+}
+
+// contains returns whether the provided strings contain the value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// historyCommand implements `sg history [flags] [uid]`, which lists the profiles of the history,
+// or the runs of the provided profile with the trends of its results. It returns the exit code.
+func historyCommand(args []string, out io.Writer) int {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	fs.SetOutput(out)
+	dir := fs.String("dir", "history", "directory of the history, as set with -history when running profiles")
+	last := fs.Int("last", 0, "only show this number of latest runs, or all if 0")
+	fs.Usage = func() {
+		fmt.Fprintln(out, "usage: sg history [flags] [uid]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+	if fs.NArg() == 0 {
+		profileDirs, err := ioutil.ReadDir(*dir)
+		if err != nil {
+			fmt.Fprintf(out, "could not read the history: %s\n", err)
+			return 2
+		}
+		for _, profileDir := range profileDirs {
+			if !profileDir.IsDir() {
+				continue
+			}
+			runs, err := loadHistory(filepath.Join(*dir, profileDir.Name()))
+			if err != nil {
+				fmt.Fprintln(out, err)
+				return 2
+			}
+			if len(runs) > 0 {
+				fmt.Fprintf(out, "%s: %d run(s), latest on %s\n", profileDir.Name(), len(runs), runs[len(runs)-1].At.Format("2006-01-02 15:04:05"))
+			}
+		}
+		return 0
+	}
+	runs, err := loadHistory(filepath.Join(*dir, historyInvalid.ReplaceAllString(fs.Arg(0), "_")))
+	if err != nil {
+		fmt.Fprintln(out, err)
+		return 2
+	}
+	if len(runs) == 0 {
+		fmt.Fprintf(out, "no run of %s in %s\n", fs.Arg(0), *dir)
+		return 2
+	}
+	if *last > 0 && len(runs) > *last {
+		runs = runs[len(runs)-*last:]
+	}
+	writeHistory(runs, out)
+	return 0
+}
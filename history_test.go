@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// historyProfile returns a profile whose responses all took the provided time, with errors on its only result.
+func historyProfile(uid string, duration time.Duration, errors int) *Profile {
+	times := []time.Duration{}
+	for i := 0; i < 100; i++ {
+		times = append(times, duration)
+	}
+	result := &Result{Method: "GET", URL: "http://example.org/items", Times: NewPercentages(times), Errors: errors,
+		Statuses: []Status{{Code: 200, Count: 100 - errors}}, StatusSum: &StatusSummary{S2xx: 100 - errors}}
+	return &Profile{Name: "History test", UID: uid, Tests: []*StressTest{{Name: "Nightly", Result: []*Result{result}}}}
+}
+
+func TestHistory(t *testing.T) {
+	Convey("Testing the history of the results", t, func() {
+		defer func(percentiles []float64) { reportedPercentiles = percentiles }(reportedPercentiles)
+		reportedPercentiles = []float64{50, 95, 99}
+		dir, _ := ioutil.TempDir("", "sg")
+		defer os.RemoveAll(dir)
+
+		Convey("Profiles are stored by UID, or by name without one", func() {
+			So(historyKey(&Profile{Name: "Some name", UID: "abc-123"}), ShouldEqual, "abc-123")
+			So(historyKey(&Profile{Name: "Some name / other"}), ShouldEqual, "Some_name_other")
+		})
+
+		Convey("Runs are saved and loaded oldest first", func() {
+			at := time.Date(2017, 7, 14, 2, 40, 0, 0, time.Local)
+			second, err := saveHistory(historyProfile("uid-1", time.Millisecond*20, 5), dir, at.Add(time.Hour))
+			So(err, ShouldBeNil)
+			So(second, ShouldEqual, filepath.Join(dir, "uid-1", "20170714-034000.000.json"))
+			first, _ := saveHistory(historyProfile("uid-1", time.Millisecond*10, 0), dir, at)
+			saveHistory(historyProfile("uid-1", time.Millisecond*30, 10), dir, at.Add(time.Hour*2))
+			ioutil.WriteFile(filepath.Join(dir, "uid-1", "notes.json"), []byte("{"), 0644)
+			runs, err := loadHistory(filepath.Join(dir, "uid-1"))
+			So(err, ShouldBeNil)
+			So(len(runs), ShouldEqual, 3)
+			So(runs[0].Filename, ShouldEqual, first)
+			So(runs[0].At, ShouldResemble, at)
+			So(runs[1].Filename, ShouldEqual, second)
+			So(runs[0].Results[0].Name, ShouldEqual, "GET http://example.org/items")
+			So(runs[1].Results[0].ErrorRate(), ShouldEqual, 5)
+
+			Convey("and runs stored at the same time are all kept", func() {
+				third, err := saveHistory(historyProfile("uid-1", time.Millisecond*40, 0), dir, at)
+				So(err, ShouldBeNil)
+				So(third, ShouldEqual, filepath.Join(dir, "uid-1", "20170714-024000.001.json"))
+				runs, _ := loadHistory(filepath.Join(dir, "uid-1"))
+				So(len(runs), ShouldEqual, 4)
+				So(runs[1].Filename, ShouldEqual, third)
+			})
+
+			Convey("Trends are shown per result", func() {
+				out := &bytes.Buffer{}
+				So(historyCommand([]string{"-dir", dir, "uid-1"}, out), ShouldEqual, 0)
+				content := out.String()
+				So(content, ShouldStartWith, "3 run(s):\n")
+				So(content, ShouldContainSubstring, "2017-07-14 02:40:00")
+				So(content, ShouldContainSubstring, "Nightly: GET http://example.org/items\n")
+				So(content, ShouldContainSubstring, "first")
+				So(content, ShouldContainSubstring, "p95")
+				So(content, ShouldContainSubstring, "p99")
+				So(content, ShouldContainSubstring, "▁▅█")
+				So(content, ShouldContainSubstring, "0.00%")
+				So(content, ShouldContainSubstring, "10.00%")
+
+				Convey("and can be limited to the latest runs", func() {
+					out := &bytes.Buffer{}
+					So(historyCommand([]string{"-dir", dir, "-last", "2", "uid-1"}, out), ShouldEqual, 0)
+					So(out.String(), ShouldStartWith, "2 run(s):\n")
+					So(out.String(), ShouldNotContainSubstring, "2017-07-14 02:40:00")
+					So(out.String(), ShouldContainSubstring, "▁█")
+				})
+			})
+
+			Convey("Profiles are listed with their number of runs", func() {
+				saveHistory(historyProfile("uid-2", time.Millisecond, 0), dir, at)
+				out := &bytes.Buffer{}
+				So(historyCommand([]string{"-dir", dir}, out), ShouldEqual, 0)
+				So(out.String(), ShouldEqual, "uid-1: 3 run(s), latest on 2017-07-14 04:40:00\n"+
+					"uid-2: 1 run(s), latest on 2017-07-14 02:40:00\n")
+			})
+		})
+
+		Convey("Sparklines scale between the lowest and highest values", func() {
+			So(sparkline([]float64{1, 2, 3, 4, 5, 6, 7, 8}), ShouldEqual, "▁▂▃▄▅▆▇█")
+			So(sparkline([]float64{5, -1, 5}), ShouldEqual, "▁ ▁")
+			So(sparkline([]float64{}), ShouldEqual, "")
+		})
+
+		Convey("Results which were not always run have gaps", func() {
+			older := &historyRun{At: time.Now(), Filename: "older.json", Results: []*comparedResult{{Test: "T", Name: "GET /old", Requests: 1}}}
+			newer := &historyRun{At: time.Now(), Filename: "newer.json", Results: []*comparedResult{{Test: "T", Name: "GET /new", Requests: 1}}}
+			out := &bytes.Buffer{}
+			writeHistory([]*historyRun{older, newer}, out)
+			content := out.String()
+			So(strings.Index(content, "T: GET /new"), ShouldBeLessThan, strings.Index(content, "T: GET /old"))
+			So(content, ShouldContainSubstring, "-")
+		})
+
+		Convey("Invalid invocations fail", func() {
+			out := &bytes.Buffer{}
+			So(historyCommand([]string{"-dir", filepath.Join(dir, "missing")}, out), ShouldEqual, 2)
+			So(historyCommand([]string{"-dir", dir, "missing"}, out), ShouldEqual, 2)
+			So(historyCommand([]string{"-dir", dir, "a", "b"}, out), ShouldEqual, 2)
+			So(historyCommand([]string{"-unknown"}, out), ShouldEqual, 2)
+		})
+	})
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jsonSchemaVersion is the version of the JSON result schema, as documented in docs/result-schema.json.
+// It is only incremented on changes which are not backward compatible.
+const jsonSchemaVersion = 1
+
+// JSONProfile is the JSON result of a profile.
+type JSONProfile struct {
+	SchemaVersion int         `json:"schemaVersion"`
+	Name          string      `json:"name"`
+	UID           string      `json:"uid"`
+	Tests         []*JSONTest `json:"tests"`
+}
+
+// JSONTest is the JSON result of a test.
+type JSONTest struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	CriticalMs  float64       `json:"criticalMs"`
+	WarningMs   float64       `json:"warningMs"`
+	ElapsedMs   float64       `json:"elapsedMs"`
+	Scenario    *JSONScenario `json:"scenario,omitempty"`
+	SLOs        []*JSONSLO    `json:"slos"`
+	Results     []*JSONResult `json:"results"`
+}
+
+// JSONScenario is the JSON result of a virtual user scenario.
+type JSONScenario struct {
+	Users      int        `json:"users"`
+	Iterations int        `json:"iterations"`
+	Times      *JSONTimes `json:"times"`
+}
+
+// JSONResult is the JSON result of a request.
+type JSONResult struct {
+	Method        string                `json:"method"`
+	URL           string                `json:"url"`
+	Concurrency   int                   `json:"concurrency"`
+	Repetitions   int                   `json:"repetitions"`
+	IntendedRate  float64               `json:"intendedRate,omitempty"`
+	AchievedRate  float64               `json:"achievedRate,omitempty"`
+	DurationMs    float64               `json:"durationMs,omitempty"`
+	Spawns        int                   `json:"spawns,omitempty"`
+	Weight        int                   `json:"weight,omitempty"`
+	Errors        int                   `json:"errors"`
+	Throughput    float64               `json:"throughput"`
+	WithCookies   bool                  `json:"withCookies"`
+	WithHeaders   bool                  `json:"withHeaders"`
+	WithData      bool                  `json:"withData"`
+	Times         *JSONTimes            `json:"times"`
+	Phases        map[string]*JSONTimes `json:"phases,omitempty"`
+	Statuses      map[string]int        `json:"statuses"`
+	StatusSummary *JSONStatusSummary    `json:"statusSummary"`
+	Assertions    *JSONAssertions       `json:"assertions,omitempty"`
+	Stages        []*JSONStage          `json:"stages,omitempty"`
+	TimeSeries    *JSONTimeSeries       `json:"timeseries,omitempty"`
+	SLOs          []*JSONSLO            `json:"slos"`
+	Spawned       []*JSONResult         `json:"spawned"`
+}
+
+// JSONTimes are the response times of a group of requests, in milliseconds.
+type JSONTimes struct {
+	Count       int                `json:"count"`
+	MeanMs      float64            `json:"meanMs"`
+	StdDevMs    float64            `json:"stddevMs"`
+	ShortestMs  float64            `json:"shortestMs"`
+	LongestMs   float64            `json:"longestMs"`
+	Percentiles map[string]float64 `json:"percentilesMs"` // Keyed by percentile, e.g. "p99.9".
+}
+
+// JSONStatusSummary is the JSON summary of the status classes.
+type JSONStatusSummary struct {
+	Errored int `json:"errored"`
+	S1xx    int `json:"1xx"`
+	S2xx    int `json:"2xx"`
+	S3xx    int `json:"3xx"`
+	S4xx    int `json:"4xx"`
+	S5xx    int `json:"5xx"`
+}
+
+// JSONAssertions is the JSON result of the assertions of a request.
+type JSONAssertions struct {
+	Passed   int                      `json:"passed"`
+	Failed   int                      `json:"failed"`
+	Failures []*JSONAssertionFailures `json:"failures"`
+}
+
+// JSONAssertionFailures is a check which failed, with its number of failures and a sample message.
+type JSONAssertionFailures struct {
+	Check  string `json:"check"`
+	Count  int    `json:"count"`
+	Sample string `json:"sample"`
+}
+
+// JSONStage is the JSON result of a load stage.
+type JSONStage struct {
+	Mode          string             `json:"mode"`
+	Target        int                `json:"target"`
+	DurationMs    float64            `json:"durationMs"`
+	Requests      int                `json:"requests"`
+	Times         *JSONTimes         `json:"times"`
+	Statuses      map[string]int     `json:"statuses"`
+	StatusSummary *JSONStatusSummary `json:"statusSummary"`
+}
+
+// JSONTimeSeries is the JSON result of the responses bucketed by completion time.
+type JSONTimeSeries struct {
+	IntervalMs float64       `json:"intervalMs"`
+	Buckets    []*JSONBucket `json:"buckets"`
+}
+
+// JSONBucket is the JSON result of the responses which completed during an interval of the run.
+type JSONBucket struct {
+	OffsetMs      float64            `json:"offsetMs"`
+	Requests      int                `json:"requests"`
+	Errors        int                `json:"errors"`
+	StatusSummary *JSONStatusSummary `json:"statusSummary"`
+	Times         *JSONTimes         `json:"times"`
+}
+
+// JSONSLO is the JSON result of a service level objective.
+type JSONSLO struct {
+	Rule   string `json:"rule"`
+	Actual string `json:"actual"`
+	Passed bool   `json:"passed"`
+}
+
+// milliseconds converts a duration to milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// newJSONProfile returns the JSON result of the provided profile, once its results were saved.
+func newJSONProfile(profile *Profile) *JSONProfile {
+	jp := &JSONProfile{SchemaVersion: jsonSchemaVersion, Name: profile.Name, UID: profile.UID, Tests: []*JSONTest{}}
+	for _, test := range profile.Tests {
+		jt := &JSONTest{Name: test.Name, Description: test.Description,
+			CriticalMs: milliseconds(test.CriticalTh.Duration), WarningMs: milliseconds(test.WarningTh.Duration),
+			ElapsedMs: milliseconds(test.elapsed), SLOs: newJSONSLOs(test.SLOs), Results: []*JSONResult{}}
+		if test.Scenario != nil && test.Scenario.Result != nil {
+			jt.Scenario = &JSONScenario{Users: test.Scenario.Users, Iterations: test.Scenario.Result.Iterations,
+				Times: newJSONTimes(test.Scenario.Result.Times)}
+		}
+		for _, result := range test.Result {
+			jt.Results = append(jt.Results, newJSONResult(result))
+		}
+		jp.Tests = append(jp.Tests, jt)
+	}
+	return jp
+}
+
+// newJSONResult returns the JSON result of a request, including its spawned requests.
+func newJSONResult(result *Result) *JSONResult {
+	jr := &JSONResult{Method: result.Method, URL: result.URL, Concurrency: result.Concurrency, Repetitions: result.Repetitions,
+		IntendedRate: result.IntendedRate, AchievedRate: result.AchievedRate, Spawns: result.Spawns, Weight: result.Weight,
+		Errors: result.Errors, Throughput: result.Throughput,
+		WithCookies: result.HadCookies, WithHeaders: result.HadHeader, WithData: result.HadData,
+		Times: newJSONTimes(result.Times), Statuses: newJSONStatuses(result.Statuses),
+		StatusSummary: newJSONStatusSummary(result.StatusSum), SLOs: newJSONSLOs(result.SLOs), Spawned: []*JSONResult{}}
+	if result.Duration != nil {
+		jr.DurationMs = milliseconds(result.Duration.Duration)
+	}
+	if result.Phases != nil {
+		jr.Phases = map[string]*JSONTimes{"dns": newJSONTimes(result.Phases.DNS), "connect": newJSONTimes(result.Phases.Connect),
+			"tls": newJSONTimes(result.Phases.TLS), "ttfb": newJSONTimes(result.Phases.TTFB), "transfer": newJSONTimes(result.Phases.Transfer)}
+	}
+	if result.Assertions != nil {
+		jr.Assertions = &JSONAssertions{Passed: result.Assertions.Passed, Failed: result.Assertions.Failed, Failures: []*JSONAssertionFailures{}}
+		for _, failures := range result.Assertions.Failures {
+			jr.Assertions.Failures = append(jr.Assertions.Failures, &JSONAssertionFailures{Check: failures.Check, Count: failures.Count, Sample: failures.Sample})
+		}
+	}
+	for _, stage := range result.Stages {
+		jr.Stages = append(jr.Stages, &JSONStage{Mode: stage.Mode, Target: stage.Target, DurationMs: milliseconds(stage.Duration.Duration),
+			Requests: stage.Requests, Times: newJSONTimes(stage.Times), Statuses: newJSONStatuses(stage.Statuses),
+			StatusSummary: newJSONStatusSummary(stage.StatusSum)})
+	}
+	if result.TimeSeries != nil {
+		jr.TimeSeries = &JSONTimeSeries{IntervalMs: milliseconds(result.TimeSeries.Interval.Duration), Buckets: []*JSONBucket{}}
+		for _, bucket := range result.TimeSeries.Buckets {
+			jr.TimeSeries.Buckets = append(jr.TimeSeries.Buckets, &JSONBucket{OffsetMs: milliseconds(bucket.Offset.Duration),
+				Requests: bucket.Requests, Errors: bucket.Errors, StatusSummary: newJSONStatusSummary(bucket.StatusSum),
+				Times: newJSONTimes(bucket.Times)})
+		}
+	}
+	for _, spawned := range result.Spawned {
+		jr.Spawned = append(jr.Spawned, newJSONResult(spawned))
+	}
+	return jr
+}
+
+// newJSONTimes returns the JSON response times of the provided percentages.
+func newJSONTimes(p *Percentages) *JSONTimes {
+	if p == nil {
+		p = NewPercentages(nil)
+	}
+	jt := &JSONTimes{Count: p.Len(), MeanMs: milliseconds(p.Mean()), StdDevMs: milliseconds(p.StdDev()),
+		ShortestMs: milliseconds(p.Percentage(0).Duration), LongestMs: milliseconds(p.Percentage(100).Duration),
+		Percentiles: map[string]float64{}}
+	for _, perc := range reportedPercentiles {
+		jt.Percentiles["p"+strconv.FormatFloat(perc, 'f', -1, 64)] = milliseconds(p.Quantile(perc).Duration)
+	}
+	return jt
+}
+
+// newJSONStatuses returns the number of responses per status code.
+func newJSONStatuses(statuses []Status) map[string]int {
+	js := map[string]int{}
+	for _, status := range statuses {
+		js[strconv.Itoa(status.Code)] = status.Count
+	}
+	return js
+}
+
+// newJSONStatusSummary returns the JSON summary of the status classes.
+func newJSONStatusSummary(summary *StatusSummary) *JSONStatusSummary {
+	if summary == nil {
+		return &JSONStatusSummary{}
+	}
+	return &JSONStatusSummary{Errored: summary.None, S1xx: summary.S1xx, S2xx: summary.S2xx,
+		S3xx: summary.S3xx, S4xx: summary.S4xx, S5xx: summary.S5xx}
+}
+
+// newJSONSLOs returns the JSON results of the provided SLOs.
+func newJSONSLOs(slos []*SLO) []*JSONSLO {
+	js := []*JSONSLO{}
+	for _, slo := range slos {
+		js = append(js, &JSONSLO{Rule: strings.TrimSpace(slo.Rule), Actual: slo.Actual, Passed: slo.Status == "passed"})
+	}
+	return js
+}
+
+// saveJSONResult writes the JSON result of the profile to the provided file.
+func saveJSONResult(profile *Profile, filename string) error {
+	content, err := json.MarshalIndent(newJSONProfile(profile), "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, content, 0644)
+}
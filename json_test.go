@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJSONResult(t *testing.T) {
+	Convey("Testing the JSON result", t, func() {
+		defer func(percentiles []float64) { reportedPercentiles = percentiles }(reportedPercentiles)
+		reportedPercentiles = []float64{50, 99.9}
+		slo := &SLO{Rule: " p50 < 1s ", Actual: "20ms", Status: "passed"}
+		child := &Result{Method: "GET", URL: "http://example.org/child", Concurrency: 1, Repetitions: 1,
+			Times: NewPercentages([]time.Duration{time.Millisecond * 5}), Statuses: []Status{{Code: 503, Count: 1}},
+			StatusSum: &StatusSummary{S5xx: 1}, Errors: 1}
+		top := &Result{Method: "POST", URL: "http://example.org/", Concurrency: 2, Repetitions: 3,
+			IntendedRate: 10, AchievedRate: 9.5, Duration: &Duration{Duration: time.Second}, Throughput: 3, HadData: true,
+			Times:      NewPercentages([]time.Duration{time.Millisecond * 10, time.Millisecond * 20, time.Millisecond * 30}),
+			Phases:     newPhases(),
+			Statuses:   []Status{{Code: 200, Count: 3}},
+			StatusSum:  &StatusSummary{S2xx: 3},
+			Assertions: &AssertionSummary{Passed: 3, Failures: []*AssertionFailures{}},
+			SLOs:       []*SLO{slo},
+			Spawned:    []*Result{child}}
+		top.TimeSeries = newTimeSeries()
+		top.TimeSeries.add(&Response{statusCode: 200, started: time.Now(), duration: time.Millisecond * 10}, time.Now(), false)
+		p := &Profile{Name: "JSON", UID: "1", Tests: []*StressTest{{Name: "JSON test", CriticalTh: Duration{Duration: time.Second},
+			WarningTh: Duration{Duration: time.Millisecond * 500}, elapsed: time.Second * 2, Result: []*Result{top}}}}
+
+		Convey("The document should follow the documented schema", func() {
+			b, err := json.Marshal(newJSONProfile(p))
+			So(err, ShouldBeNil)
+			doc := map[string]interface{}{}
+			So(json.Unmarshal(b, &doc), ShouldBeNil)
+			So(doc["schemaVersion"], ShouldEqual, 1)
+			test := doc["tests"].([]interface{})[0].(map[string]interface{})
+			So(test["criticalMs"], ShouldEqual, 1000)
+			So(test["warningMs"], ShouldEqual, 500)
+			So(test["elapsedMs"], ShouldEqual, 2000)
+			So(test["slos"], ShouldBeEmpty)
+			So(test["scenario"], ShouldBeNil)
+			result := test["results"].([]interface{})[0].(map[string]interface{})
+			So(result["method"], ShouldEqual, "POST")
+			So(result["durationMs"], ShouldEqual, 1000)
+			So(result["achievedRate"], ShouldEqual, 9.5)
+			So(result["withData"], ShouldBeTrue)
+			So(result["statuses"], ShouldResemble, map[string]interface{}{"200": 3.0})
+			So(result["statusSummary"].(map[string]interface{})["2xx"], ShouldEqual, 3)
+			So(result["slos"], ShouldResemble, []interface{}{map[string]interface{}{"rule": "p50 < 1s", "actual": "20ms", "passed": true}})
+			So(result["assertions"], ShouldResemble, map[string]interface{}{"passed": 3.0, "failed": 0.0, "failures": []interface{}{}})
+			So(result["stages"], ShouldBeNil)
+			series := result["timeseries"].(map[string]interface{})
+			So(series["intervalMs"], ShouldEqual, milliseconds(bucketInterval))
+			bucket := series["buckets"].([]interface{})[0].(map[string]interface{})
+			So(bucket["offsetMs"], ShouldEqual, 0)
+			So(bucket["requests"], ShouldEqual, 1)
+			So(bucket["statusSummary"].(map[string]interface{})["2xx"], ShouldEqual, 1)
+			times := result["times"].(map[string]interface{})
+			So(times["count"], ShouldEqual, 3)
+			So(times["meanMs"], ShouldAlmostEqual, 20, 0.1)
+			So(times["shortestMs"], ShouldAlmostEqual, 10, 0.1)
+			So(times["longestMs"], ShouldAlmostEqual, 30, 0.1)
+			percentiles := times["percentilesMs"].(map[string]interface{})
+			So(len(percentiles), ShouldEqual, 2)
+			So(percentiles["p50"], ShouldAlmostEqual, 20, 0.1)
+			So(percentiles["p99.9"], ShouldAlmostEqual, 30, 0.1)
+			So(result["phases"].(map[string]interface{})["ttfb"].(map[string]interface{})["count"], ShouldEqual, 0)
+			spawned := result["spawned"].([]interface{})[0].(map[string]interface{})
+			So(spawned["url"], ShouldEqual, "http://example.org/child")
+			So(spawned["errors"], ShouldEqual, 1)
+			So(spawned["spawned"], ShouldBeEmpty)
+		})
+		Convey("Both formats can be saved", func() {
+			defer func(format string) { outputFormat = format }(outputFormat)
+			outputFormat = "both"
+			// The results are moved from the requests when saving them.
+			p.Tests[0].Requests = []*Request{{Result: top}}
+			dir, _ := ioutil.TempDir("", "sg")
+			defer os.RemoveAll(dir)
+			filenames := saveResult(p, filepath.Join(dir, "profile.xml"))
+			So(len(filenames), ShouldEqual, 2)
+			So(filepath.Ext(filenames[0]), ShouldEqual, ".xml")
+			So(filepath.Ext(filenames[1]), ShouldEqual, ".json")
+			content, err := ioutil.ReadFile(filenames[1])
+			So(err, ShouldBeNil)
+			loaded := JSONProfile{}
+			So(json.Unmarshal(content, &loaded), ShouldBeNil)
+			So(loaded.Tests[0].Results[0].Spawned[0].StatusSummary.S5xx, ShouldEqual, 1)
+		})
+	})
+}
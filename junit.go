@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// JUnitTestSuites is the root of a JUnit report, with one test suite per test.
+type JUnitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Name     string            `xml:"name,attr"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Time     string            `xml:"time,attr"`
+	Suites   []*JUnitTestSuite `xml:"testsuite"`
+}
+
+// JUnitTestSuite is the JUnit report of a test, with one test case per result.
+type JUnitTestSuite struct {
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Cases    []*JUnitTestCase `xml:"testcase"`
+}
+
+// JUnitTestCase is the JUnit report of a result.
+type JUnitTestCase struct {
+	ClassName string          `xml:"classname,attr"`
+	Name      string          `xml:"name,attr"`
+	Time      string          `xml:"time,attr"`
+	Failures  []*JUnitFailure `xml:"failure"`
+	SystemOut string          `xml:"system-out,omitempty"`
+}
+
+// JUnitFailure is a breached threshold of a result.
+type JUnitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Details string `xml:",chardata"`
+}
+
+// seconds formats a number of seconds as expected by JUnit.
+func seconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', 3, 64)
+}
+
+// newJUnitTestSuites returns the JUnit report of the provided profile, once its results were saved.
+func newJUnitTestSuites(profile *Profile) *JUnitTestSuites {
+	suites := &JUnitTestSuites{Name: profile.Name}
+	var elapsed float64
+	for _, test := range profile.Tests {
+		suite := &JUnitTestSuite{Name: test.Name, Time: seconds(test.elapsed.Seconds())}
+		var visit func(results []*Result, parent string)
+		visit = func(results []*Result, parent string) {
+			for _, result := range results {
+				name := fmt.Sprintf("%s %s", result.Method, result.URL)
+				if parent != "" {
+					name = parent + " > " + name
+				}
+				suite.Cases = append(suite.Cases, newJUnitTestCase(test, result, name))
+				visit(result.Spawned, name)
+			}
+		}
+		visit(test.Result, "")
+		if len(test.SLOs) > 0 {
+			tc := &JUnitTestCase{ClassName: test.Name, Name: "service level objectives", Time: seconds(0)}
+			for _, slo := range test.SLOs {
+				if slo.Status != "passed" {
+					tc.Failures = append(tc.Failures, &JUnitFailure{Type: "slo",
+						Message: fmt.Sprintf("SLO %s not met: actual %s", strings.TrimSpace(slo.Rule), slo.Actual)})
+				}
+			}
+			suite.Cases = append(suite.Cases, tc)
+		}
+		for _, tc := range suite.Cases {
+			if len(tc.Failures) > 0 {
+				suite.Failures++
+			}
+		}
+		suite.Tests = len(suite.Cases)
+		suites.Tests += suite.Tests
+		suites.Failures += suite.Failures
+		elapsed += test.elapsed.Seconds()
+		suites.Suites = append(suites.Suites, suite)
+	}
+	suites.Time = seconds(elapsed)
+	return suites
+}
+
+// newJUnitTestCase returns the JUnit test case of a result. It fails if any reported percentile reaches the
+// critical threshold of the test, if any response errored, had a 5xx status or failed assertions, or if any SLO was not met.
+func newJUnitTestCase(test *StressTest, result *Result, name string) *JUnitTestCase {
+	tc := &JUnitTestCase{ClassName: test.Name, Name: name, Time: seconds(0)}
+	if result.Throughput > 0 {
+		tc.Time = seconds(float64(result.Times.Len()) / result.Throughput)
+	}
+	if critical := test.CriticalTh.Duration; critical > 0 {
+		for _, perc := range reportedPercentiles {
+			if dur := result.Times.Quantile(perc).Duration; dur >= critical {
+				tc.Failures = append(tc.Failures, &JUnitFailure{Type: "threshold",
+					Message: fmt.Sprintf("p%s of %s reached the critical threshold of %s", strconv.FormatFloat(perc, 'f', -1, 64), dur, critical)})
+				break // The higher percentiles are also critical.
+			}
+		}
+	}
+	if result.Errors > 0 {
+		failure := &JUnitFailure{Type: "errors", Message: fmt.Sprintf("%d of %d response(s) errored, had a 5xx status or failed assertions",
+			result.Errors, result.Times.Len())}
+		if result.Assertions != nil {
+			for _, failures := range result.Assertions.Failures {
+				failure.Details += fmt.Sprintf("%s: failed %d time(s), e.g. %s\n", failures.Check, failures.Count, failures.Sample)
+			}
+		}
+		tc.Failures = append(tc.Failures, failure)
+	}
+	for _, slo := range result.SLOs {
+		if slo.Status != "passed" {
+			tc.Failures = append(tc.Failures, &JUnitFailure{Type: "slo",
+				Message: fmt.Sprintf("SLO %s not met: actual %s", strings.TrimSpace(slo.Rule), slo.Actual)})
+		}
+	}
+	tc.SystemOut = fmt.Sprintf("%d request(s) (concurrency=%d): %s", result.Times.Len(), result.Concurrency, result.Times)
+	if result.StatusSum != nil {
+		tc.SystemOut += fmt.Sprintf("\nStatuses: %d errored, %d 1xx, %d 2xx, %d 3xx, %d 4xx, %d 5xx", result.StatusSum.None,
+			result.StatusSum.S1xx, result.StatusSum.S2xx, result.StatusSum.S3xx, result.StatusSum.S4xx, result.StatusSum.S5xx)
+	}
+	return tc
+}
+
+// saveJUnitResult writes the JUnit report of the profile to the provided file.
+func saveJUnitResult(profile *Profile, filename string) error {
+	content, err := xml.MarshalIndent(newJUnitTestSuites(profile), "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, []byte(xml.Header+string(content)+"\n"), 0644)
+}
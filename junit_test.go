@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestJUnitResult(t *testing.T) {
+	Convey("Testing the JUnit report", t, func() {
+		defer func(percentiles []float64) { reportedPercentiles = percentiles }(reportedPercentiles)
+		reportedPercentiles = []float64{50, 95, 99}
+		fast := []time.Duration{}
+		for i := 0; i < 100; i++ {
+			fast = append(fast, time.Millisecond*10)
+		}
+		slow := append(fast[:90:90], time.Second*2, time.Second*2, time.Second*2, time.Second*2, time.Second*2,
+			time.Second*2, time.Second*2, time.Second*2, time.Second*2, time.Second*2)
+		child := &Result{Method: "GET", URL: "http://example.org/slow", Concurrency: 1, Times: NewPercentages(slow), Throughput: 50}
+		top := &Result{Method: "POST", URL: "http://example.org/", Concurrency: 2, Times: NewPercentages(fast), Throughput: 100,
+			StatusSum: &StatusSummary{S2xx: 100}, Spawned: []*Result{child}}
+		errored := &Result{Method: "GET", URL: "http://example.org/errors", Times: NewPercentages(fast), Errors: 3,
+			Assertions: &AssertionSummary{Passed: 97, Failed: 3, Failures: []*AssertionFailures{{Check: "status 2xx", Count: 3, Sample: "got status 500"}}},
+			SLOs:       []*SLO{{Rule: "error rate < 1%", Actual: "3.000%", Status: "failed"}, {Rule: "p50 < 1s", Actual: "10ms", Status: "passed"}}}
+		p := &Profile{Name: "JUnit", Tests: []*StressTest{
+			{Name: "First", CriticalTh: Duration{Duration: time.Second}, elapsed: time.Second * 2, Result: []*Result{top, errored},
+				SLOs: []*SLO{{Rule: "throughput > 1rps", Actual: "150.00rps", Status: "passed"}}},
+			{Name: "No threshold", elapsed: time.Second, Result: []*Result{child}},
+		}}
+
+		suites := newJUnitTestSuites(p)
+		So(suites.Name, ShouldEqual, "JUnit")
+		So(suites.Tests, ShouldEqual, 5)
+		So(suites.Failures, ShouldEqual, 2)
+		So(suites.Time, ShouldEqual, "3.000")
+		first := suites.Suites[0]
+		So(first.Name, ShouldEqual, "First")
+		So(first.Tests, ShouldEqual, 4)
+		So(first.Failures, ShouldEqual, 2)
+		So(first.Cases[0].Name, ShouldEqual, "POST http://example.org/")
+		So(first.Cases[0].ClassName, ShouldEqual, "First")
+		So(first.Cases[0].Time, ShouldEqual, "1.000")
+		So(first.Cases[0].Failures, ShouldBeEmpty)
+		So(first.Cases[0].SystemOut, ShouldStartWith, "100 request(s) (concurrency=2): Shortest: 10ms")
+		So(first.Cases[1].Name, ShouldEqual, "POST http://example.org/ > GET http://example.org/slow")
+		So(len(first.Cases[1].Failures), ShouldEqual, 1)
+		So(first.Cases[1].Failures[0].Type, ShouldEqual, "threshold")
+		So(first.Cases[1].Failures[0].Message, ShouldStartWith, "p95 of 2.")
+		So(first.Cases[2].Name, ShouldEqual, "GET http://example.org/errors")
+		So(len(first.Cases[2].Failures), ShouldEqual, 2)
+		So(first.Cases[2].Failures[0].Message, ShouldEqual, "3 of 100 response(s) errored, had a 5xx status or failed assertions")
+		So(first.Cases[2].Failures[0].Details, ShouldEqual, "status 2xx: failed 3 time(s), e.g. got status 500\n")
+		So(first.Cases[2].Failures[1].Message, ShouldEqual, "SLO error rate < 1% not met: actual 3.000%")
+		So(first.Cases[3].Name, ShouldEqual, "service level objectives")
+		So(first.Cases[3].Failures, ShouldBeEmpty)
+		// Without a critical threshold, response times never fail a test case.
+		So(suites.Suites[1].Failures, ShouldEqual, 0)
+
+		dir, _ := ioutil.TempDir("", "sg")
+		defer os.RemoveAll(dir)
+		filename := filepath.Join(dir, "junit.xml")
+		So(saveJUnitResult(p, filename), ShouldBeNil)
+		content, err := ioutil.ReadFile(filename)
+		So(err, ShouldBeNil)
+		So(strings.HasPrefix(string(content), xml.Header+`<testsuites name="JUnit" tests="5" failures="2" time="3.000">`), ShouldBeTrue)
+		So(string(content), ShouldContainSubstring, `<failure message="SLO error rate &lt; 1% not met: actual 3.000%" type="slo"></failure>`)
+	})
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// metricsBuckets are the upper bounds of the buckets of the latency histograms, in seconds.
+var metricsBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics exposes the live metrics of the run in the Prometheus exposition format.
+type Metrics struct {
+	mutex    sync.Mutex
+	requests map[*Request]*requestMetrics
+	order    []*requestMetrics // In the order the requests were watched, for a stable output.
+}
+
+// requestMetrics are the metrics of one request of a test.
+type requestMetrics struct {
+	test     string
+	index    string // Position of the request in the test, e.g. 1.2 for the second child of the first request.
+	request  string
+	ongoing  *int32 // Number of requests in flight, updated atomically by the request.
+	statuses map[string]int
+	buckets  []int // Number of responses per latency bucket, not cumulative.
+	count    int
+	sum      float64 // Sum of the response times, in seconds.
+	sent     int64   // Bytes of the request bodies.
+	received int64   // Bytes of the response bodies.
+}
+
+// newMetrics returns an empty set of metrics.
+func newMetrics() *Metrics {
+	return &Metrics{requests: make(map[*Request]*requestMetrics)}
+}
+
+// Serve exposes the metrics on /metrics of the provided address, e.g. ":9100", until sg exits.
+func (m *Metrics) Serve(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m)
+	go http.Serve(ln, mux)
+	return nil
+}
+
+// Watch registers the requests of the provided test, including children and mix entries, so that
+// they are exposed before their first response. It must be called before the test starts.
+func (m *Metrics) Watch(test *StressTest) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var visit func(requests []*Request, parent string)
+	visit = func(requests []*Request, parent string) {
+		for rno, r := range requests {
+			index := strconv.Itoa(rno + 1)
+			if parent != "" {
+				index = parent + "." + index
+			}
+			rm := &requestMetrics{test: test.Name, index: index, request: fmt.Sprintf("%s %s", r.Method, r.URL), ongoing: &r.inFlight,
+				statuses: make(map[string]int), buckets: make([]int, len(metricsBuckets))}
+			m.requests[r] = rm
+			m.order = append(m.order, rm)
+			visit(r.Children, index)
+		}
+	}
+	visit(test.Requests, "")
+	if test.Mix != nil {
+		visit(test.Mix.Requests, "mix")
+	}
+}
+
+// observe records the provided response of a request, if that request is watched.
+func (m *Metrics) observe(r *Request, resp *Response) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	rm, exists := m.requests[r]
+	if !exists {
+		return
+	}
+	code := "errored"
+	if resp.statusCode != -1 {
+		code = strconv.Itoa(resp.statusCode)
+	}
+	rm.statuses[code]++
+	seconds := resp.duration.Seconds()
+	for bno, le := range metricsBuckets {
+		if seconds <= le {
+			rm.buckets[bno]++
+			break
+		}
+	}
+	rm.count++
+	rm.sum += seconds
+	rm.sent += resp.sent
+	rm.received += resp.received
+}
+
+// ServeHTTP implements the http.Handler interface by writing all the metrics.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(m.Bytes())
+}
+
+// Bytes returns all the metrics in the Prometheus text exposition format.
+func (m *Metrics) Bytes() []byte {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var buf bytes.Buffer
+	buf.WriteString("# HELP sg_requests_total Responses received, by status code (errored if no response was received).\n")
+	buf.WriteString("# TYPE sg_requests_total counter\n")
+	for _, rm := range m.order {
+		codes := make([]string, 0, len(rm.statuses))
+		for code := range rm.statuses {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		for _, code := range codes {
+			fmt.Fprintf(&buf, "sg_requests_total{%s,code=\"%s\"} %d\n", rm.labels(), code, rm.statuses[code])
+		}
+	}
+	buf.WriteString("# HELP sg_request_duration_seconds Response times.\n")
+	buf.WriteString("# TYPE sg_request_duration_seconds histogram\n")
+	for _, rm := range m.order {
+		cumulative := 0
+		for bno, le := range metricsBuckets {
+			cumulative += rm.buckets[bno]
+			fmt.Fprintf(&buf, "sg_request_duration_seconds_bucket{%s,le=\"%s\"} %d\n", rm.labels(), strconv.FormatFloat(le, 'f', -1, 64), cumulative)
+		}
+		fmt.Fprintf(&buf, "sg_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", rm.labels(), rm.count)
+		fmt.Fprintf(&buf, "sg_request_duration_seconds_sum{%s} %s\n", rm.labels(), strconv.FormatFloat(rm.sum, 'f', -1, 64))
+		fmt.Fprintf(&buf, "sg_request_duration_seconds_count{%s} %d\n", rm.labels(), rm.count)
+	}
+	buf.WriteString("# HELP sg_requests_in_flight Requests sent which did not complete yet.\n")
+	buf.WriteString("# TYPE sg_requests_in_flight gauge\n")
+	for _, rm := range m.order {
+		fmt.Fprintf(&buf, "sg_requests_in_flight{%s} %d\n", rm.labels(), atomic.LoadInt32(rm.ongoing))
+	}
+	buf.WriteString("# HELP sg_sent_bytes_total Bytes of the request bodies sent.\n")
+	buf.WriteString("# TYPE sg_sent_bytes_total counter\n")
+	for _, rm := range m.order {
+		fmt.Fprintf(&buf, "sg_sent_bytes_total{%s} %d\n", rm.labels(), rm.sent)
+	}
+	buf.WriteString("# HELP sg_received_bytes_total Bytes of the response bodies received.\n")
+	buf.WriteString("# TYPE sg_received_bytes_total counter\n")
+	for _, rm := range m.order {
+		fmt.Fprintf(&buf, "sg_received_bytes_total{%s} %d\n", rm.labels(), rm.received)
+	}
+	return buf.Bytes()
+}
+
+// labelEscaper escapes label values as required by the exposition format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels returns the test, index and request labels of these metrics. The index tells apart the requests
+// with the same method and URL, e.g. a template used twice.
+func (rm *requestMetrics) labels() string {
+	return fmt.Sprintf(`test="%s",index="%s",request="%s"`, labelEscaper.Replace(rm.test), rm.index, labelEscaper.Replace(rm.request))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMetrics(t *testing.T) {
+	Convey("Testing the Prometheus metrics", t, func() {
+		release := make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasSuffix(r.URL.Path, "/slow") {
+				<-release
+			}
+			if strings.HasSuffix(r.URL.Path, "/missing") {
+				w.WriteHeader(404)
+			}
+			w.Write([]byte("0123456789"))
+		}))
+		defer ts.Close()
+		profile = &Profile{UserAgent: "StressGauge/0.x"}
+		child := &Request{Method: "get", Repeat: 2, Concurrency: 1, URL: &URL{Base: ts.URL + "/missing"}}
+		r := &Request{Method: "post", Repeat: 4, Concurrency: 2, URL: &URL{Base: ts.URL + "/\"quoted\""},
+			Data: &Tokenized{Data: "hello"}, Children: []*Request{child}}
+		r.Validate()
+		child.Validate()
+		test := &StressTest{Name: "Metrics test", Requests: []*Request{r}}
+
+		defer func(m *Metrics) { metrics = m }(metrics)
+		metrics = newMetrics()
+		metrics.Watch(test)
+		unwatched := &Request{Method: "get", Repeat: 1, Concurrency: 1, URL: &URL{Base: ts.URL}}
+		unwatched.Validate()
+		metrics.observe(unwatched, &Response{statusCode: 200})
+		So(len(metrics.order), ShouldEqual, 2)
+
+		var wg sync.WaitGroup
+		r.Spawn(nil, &wg)
+		wg.Wait()
+
+		rec := httptest.NewRecorder()
+		metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		So(rec.Header().Get("Content-Type"), ShouldStartWith, "text/plain; version=0.0.4")
+		content := rec.Body.String()
+		parent := `test="Metrics test",index="1",request="POST ` + ts.URL + `/\"quoted\""`
+		children := `test="Metrics test",index="1.1",request="GET ` + ts.URL + `/missing"`
+		So(content, ShouldContainSubstring, "# TYPE sg_requests_total counter\n")
+		So(content, ShouldContainSubstring, "sg_requests_total{"+parent+`,code="200"} 4`+"\n")
+		So(content, ShouldContainSubstring, "sg_requests_total{"+children+`,code="404"} 2`+"\n")
+		So(content, ShouldContainSubstring, "# TYPE sg_request_duration_seconds histogram\n")
+		So(content, ShouldContainSubstring, "sg_request_duration_seconds_bucket{"+parent+`,le="+Inf"} 4`+"\n")
+		So(content, ShouldContainSubstring, "sg_request_duration_seconds_bucket{"+parent+`,le="10"} 4`+"\n")
+		So(content, ShouldContainSubstring, "sg_request_duration_seconds_count{"+children+"} 2\n")
+		So(content, ShouldContainSubstring, "sg_requests_in_flight{"+parent+"} 0\n")
+		So(content, ShouldContainSubstring, "sg_sent_bytes_total{"+parent+"} 20\n")
+		So(content, ShouldContainSubstring, "sg_received_bytes_total{"+parent+"} 40\n")
+		So(content, ShouldContainSubstring, "sg_received_bytes_total{"+children+"} 20\n")
+		So(strings.Index(content, parent), ShouldBeLessThan, strings.Index(content, children))
+
+		Convey("Requests which do not go through the concurrency limit, e.g. timed ones, are counted in flight", func() {
+			slow := &Request{Method: "get", Concurrency: 1, Duration: Duration{Duration: time.Second}, URL: &URL{Base: ts.URL + "/slow"}}
+			slow.Validate()
+			metrics.Watch(&StressTest{Name: "Slow", Requests: []*Request{slow}})
+			done := make(chan struct{})
+			go func() {
+				slow.do(1, slow.prepare(nil), time.Time{}, slow.URL.Generate())
+				close(done)
+			}()
+			for atomic.LoadInt32(&slow.inFlight) == 0 {
+				time.Sleep(time.Millisecond)
+			}
+			rec := httptest.NewRecorder()
+			metrics.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+			So(rec.Body.String(), ShouldContainSubstring, `sg_requests_in_flight{test="Slow",index="1",request="GET `+ts.URL+`/slow"} 1`+"\n")
+			close(release)
+			<-done
+			So(atomic.LoadInt32(&slow.inFlight), ShouldEqual, 0)
+		})
+
+		Convey("Requests to the same method and URL are told apart by their index", func() {
+			twice := newMetrics()
+			entries := []*Request{{Method: "GET", URL: &URL{Base: ts.URL}}, {Method: "GET", URL: &URL{Base: ts.URL}}}
+			twice.Watch(&StressTest{Name: "Twice", Mix: &Mix{Requests: entries}})
+			content := string(twice.Bytes())
+			So(content, ShouldContainSubstring, `sg_requests_in_flight{test="Twice",index="mix.1",request="GET `+ts.URL+`"} 0`+"\n")
+			So(content, ShouldContainSubstring, `sg_requests_in_flight{test="Twice",index="mix.2",request="GET `+ts.URL+`"} 0`+"\n")
+		})
+
+		Convey("An address which cannot be listened on is an error", func() {
+			So(newMetrics().Serve("not an address"), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmcvetta/randutil"
+)
+
+// Mix stores a weighted blend of requests which are sent by a shared pool of concurrent requests.
+type Mix struct {
+	Concurrency int        `xml:"concurrency,attr" json:"concurrency" yaml:"concurrency"`                // Number of concurrent requests shared by all the entries.
+	Repeat      int        `xml:"repeat,attr,omitempty" json:"repeat,omitempty" yaml:"repeat,omitempty"` // Total number of requests to send, across all the entries.
+	Duration    Duration   `xml:"duration,attr" json:"duration,omitzero" yaml:"duration,omitempty"`      // Duration during which to send requests.
+	Requests    []*Request `xml:"request" json:"requests" yaml:"requests"`                               // Entries of this mix, each with its own weight.
+}
+
+// Validate confirms that a mix is correctly defined, and returns all its problems as ValidationErrors otherwise.
+func (m *Mix) Validate() error {
+	errs := ValidationErrors{}
+	if m.Concurrency <= 0 {
+		errs.add("", errors.New("mix must have a positive concurrency"))
+	}
+	if m.Repeat <= 0 && m.Duration.Duration <= 0 {
+		errs.add("", errors.New("mix requires either a repeat or a duration"))
+	}
+	if len(m.Requests) == 0 {
+		errs.add("", errors.New("mix does not have any request"))
+	}
+	for rno, r := range m.Requests {
+		path := elementPath("", "request", rno+1, "")
+		if r.Weight <= 0 {
+			errs.add(path, fmt.Errorf("weight of %d in mix entry to %s must be positive", r.Weight, r.URL))
+		}
+		if r.Children != nil {
+			errs.add(path, fmt.Errorf("mix entry to %s cannot have children", r.URL))
+		}
+		if r.isTimed() || r.Rate.IsSet() {
+			errs.add(path, fmt.Errorf("mix entry to %s cannot be bound by time or rate", r.URL))
+			continue
+		}
+		if r.Repeat != 0 || r.Concurrency != 0 {
+			log.Warning("repeat and concurrency definitions have no effect in mix entries")
+			r.Repeat = 0
+			r.Concurrency = 0
+		}
+		errs.add(path, r.Validate())
+	}
+	return errs.orNil()
+}
+
+func (m Mix) String() string {
+	return fmt.Sprintf("mix of %d request(s) (concurrency=%d, repeat=%d, duration=%s)", len(m.Requests), m.Concurrency, m.Repeat, m.Duration.String())
+}
+
+// Run sends the requests of the mix, picking each entry according to its weight, until either
+// the number of requests is reached or the duration is over. It then computes the result of each entry.
+func (m *Mix) Run(wg *sync.WaitGroup) {
+	wg.Add(1) // Holds the wait group until the results are computed.
+	choices := make([]randutil.Choice, len(m.Requests))
+	for i, r := range m.Requests {
+		// The entries are reported with the concurrency of the mix, which they share.
+		r.Concurrency = m.Concurrency
+		choices[i] = randutil.Choice{Weight: r.Weight, Item: r}
+	}
+	go func() {
+		var deadline time.Time
+		if m.Duration.Duration > 0 {
+			deadline = time.Now().Add(m.Duration.Duration)
+		}
+		var sent int64
+		var workersWg sync.WaitGroup
+		for w := 0; w < m.Concurrency; w++ {
+			workersWg.Add(1)
+			go func() {
+				defer workersWg.Done()
+				for {
+					if !deadline.IsZero() && time.Now().After(deadline) {
+						return
+					}
+					no := atomic.AddInt64(&sent, 1)
+					if m.Repeat > 0 && no > int64(m.Repeat) {
+						return
+					}
+					choice, _ := randutil.WeightedChoice(choices)
+					r := choice.Item.(*Request)
+					r.collectOnce.Do(func() { go r.collect(wg) })
+					atomic.AddInt64(&r.sent, 1)
+					wg.Add(1)
+					r.doneWg.Add(1)
+					r.doneChan <- r.do(int(no), r.prepare(nil), time.Time{}, r.URL.Generate())
+				}
+			}()
+		}
+		workersWg.Wait()
+
+		for _, r := range m.Requests {
+			r.doneWg.Wait()
+			r.ComputeResult(wg)
+		}
+		wg.Done()
+	}()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestMix(t *testing.T) {
+	Convey("Testing request mixes", t, func() {
+		entry := func(weight int) *Request {
+			return &Request{Method: "get", Weight: weight, URL: &URL{Base: "http://example.org/"}}
+		}
+		Convey("Invalid mixes should fail validation", func() {
+			So((&Mix{Repeat: 10, Requests: []*Request{entry(1)}}).Validate(), ShouldNotBeNil)
+			So((&Mix{Concurrency: 1, Requests: []*Request{entry(1)}}).Validate(), ShouldNotBeNil)
+			So((&Mix{Concurrency: 1, Repeat: 10}).Validate(), ShouldNotBeNil)
+			So((&Mix{Concurrency: 1, Repeat: 10, Requests: []*Request{entry(0)}}).Validate(), ShouldNotBeNil)
+			withChild := entry(1)
+			withChild.Children = []*Request{entry(1)}
+			So((&Mix{Concurrency: 1, Repeat: 10, Requests: []*Request{withChild}}).Validate(), ShouldNotBeNil)
+			timed := entry(1)
+			timed.Duration = Duration{Duration: time.Second}
+			So((&Mix{Concurrency: 1, Repeat: 10, Requests: []*Request{timed}}).Validate(), ShouldNotBeNil)
+		})
+		Convey("A mix is read from XML and inherits the test duration", func() {
+			p := Profile{}
+			xml.Unmarshal([]byte(`<sg><test name="Mix" duration="1m"><mix concurrency="50">
+				<request method="get" weight="70"><url base="http://example.org/search" /></request>
+				<request method="post" weight="30"><url base="http://example.org/cart" /></request>
+			</mix></test></sg>`), &p)
+			So(p.Validate(), ShouldBeNil)
+			So(p.Tests[0].Mix.Concurrency, ShouldEqual, 50)
+			So(p.Tests[0].Mix.Duration.Duration, ShouldEqual, time.Minute)
+			So(len(p.Tests[0].Mix.Requests), ShouldEqual, 2)
+			So(p.Tests[0].Mix.Requests[1].Weight, ShouldEqual, 30)
+		})
+		Convey("The requests are picked according to their weight", func() {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(204)
+			}))
+			defer ts.Close()
+			profile = &Profile{UserAgent: "StressGauge/0.x"}
+			m := Mix{Concurrency: 10, Repeat: 2000, Requests: []*Request{
+				{Method: "get", Weight: 70, URL: &URL{Base: ts.URL + "/search"}},
+				{Method: "get", Weight: 20, URL: &URL{Base: ts.URL + "/item"}},
+				{Method: "post", Weight: 10, URL: &URL{Base: ts.URL + "/cart"}},
+			}}
+			m.Validate()
+			var wg sync.WaitGroup
+			m.Run(&wg)
+			wg.Wait()
+			total := 0
+			for _, r := range m.Requests {
+				So(r.Result.Weight, ShouldEqual, r.Weight)
+				So(r.Result.Concurrency, ShouldEqual, 10)
+				So(r.Result.StatusSum.S2xx, ShouldEqual, r.Result.Repetitions)
+				So(r.Result.Repetitions, ShouldBeBetween, r.Weight*20-100, r.Weight*20+100)
+				total += r.Result.Repetitions
+			}
+			So(total, ShouldEqual, 2000)
+		})
+	})
+}
@@ -7,47 +7,130 @@ import (
 	"fmt"
 	"github.com/jmcvetta/randutil"
 	"io/ioutil"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 )
 
-// Profile stores the whole test profile
+// Profile stores the whole test profile, as loaded from XML, JSON or YAML.
 type Profile struct {
-	Name      string        `xml:"name,attr"`
-	UID       string        `xml:"uid,attr"`
-	UserAgent string        `xml:"user-agent,attr"`
-	Tests     []*StressTest `xml:"test"`
+	Name        string        `xml:"name,attr" json:"name" yaml:"name"`
+	UID         string        `xml:"uid,attr" json:"uid,omitempty" yaml:"uid,omitempty"`
+	UserAgent   string        `xml:"user-agent,attr,omitempty" json:"user-agent,omitempty" yaml:"user-agent,omitempty"`
+	Precision   int           `xml:"precision,attr,omitempty" json:"precision,omitempty" yaml:"precision,omitempty"`       // Significant figures of the response time histograms, from 1 to 5.
+	Percentiles string        `xml:"percentiles,attr,omitempty" json:"percentiles,omitempty" yaml:"percentiles,omitempty"` // Comma separated percentiles to report, e.g. "50,90,99,99.9".
+	Interval    Duration      `xml:"interval,attr" json:"interval,omitzero" yaml:"interval,omitempty"`                     // Width of the buckets of the time series, defaults to 1s.
+	Includes    []*Include    `xml:"include" json:"includes,omitempty" yaml:"includes,omitempty"`                          // Fragments whose templates and tests are added, when the profile is read.
+	Variables   Variables     `xml:"variables,omitempty" json:"variables,omitempty" yaml:"variables,omitempty"`            // Variables referenced as ${NAME}, resolved when the profile is read.
+	Templates   []*Template   `xml:"template" json:"templates,omitempty" yaml:"templates,omitempty"`                       // Requests which other requests use as their defaults.
+	Tests       []*StressTest `xml:"test" json:"tests" yaml:"tests"`
 }
 
-// Validate confirms that a profile is valid and sets the parent to all children requests.
+// Validate confirms that a profile is valid, applies the templates and sets the parent to all children requests.
+// It returns all the problems of the profile as ValidationErrors.
 func (p *Profile) Validate() error {
+	errs := ValidationErrors{}
+	errs.add("", p.applyTemplates())
+	if p.Precision < 0 || p.Precision > 5 {
+		errs.add("", errors.New("precision must be between 1 and 5"))
+	} else if p.Precision > 0 {
+		significantFigures = p.Precision
+	}
+	if p.Percentiles != "" {
+		percentiles, err := ParsePercentiles(p.Percentiles)
+		if err != nil {
+			errs.add("", err)
+		} else {
+			reportedPercentiles = percentiles
+		}
+	}
+	if p.Interval.Duration < 0 {
+		errs.add("", errors.New("interval must be positive"))
+	} else if p.Interval.Duration > 0 {
+		bucketInterval = p.Interval.Duration
+	}
+	declared := map[string]bool{}
+	for vno, v := range p.Variables {
+		path := elementPath("variables", "var", vno+1, v.Name)
+		if err := v.Validate(); err != nil {
+			errs.add(path, err)
+		} else if declared[v.Name] {
+			errs.add(path, fmt.Errorf("variable %s is declared twice", v.Name))
+		}
+		declared[v.Name] = true
+	}
 	// Let's set the parent requests on all children.
-	for _, test := range p.Tests {
-		if test.Requests == nil || len(test.Requests) == 0 {
-			return fmt.Errorf("error loading profile %s: there are no requests to send\n", profileFile)
+	for tno, test := range p.Tests {
+		path := elementPath("", "test", tno+1, test.Name)
+		if len(test.Requests) == 0 && test.Mix == nil {
+			errs.add(path, errors.New("there are no requests to send"))
+		}
+		if test.Mix != nil && test.Scenario != nil {
+			errs.add(path, errors.New("a test cannot have both a mix and a scenario"))
+		}
+
+		stagesValid := true
+		if test.Stages != nil && test.Duration.Duration > 0 {
+			errs.add(path, errors.New("a test cannot have both stages and a duration"))
+			stagesValid = false
+		}
+		for sno, stage := range test.Stages {
+			if err := stage.Validate(); err != nil {
+				errs.add(elementPath(joinPath(path, "stages"), "stage", sno+1, ""), err)
+				stagesValid = false
+			}
+		}
+
+		for sno, slo := range test.SLOs {
+			errs.add(elementPath(path, "slo", sno+1, ""), slo.Validate())
 		}
 
-		for _, request := range test.Requests {
-			request.Validate()
+		for rno, request := range test.Requests {
+			requestPath := elementPath(path, "request", rno+1, "")
+			if test.Scenario == nil && request.Repeat == 0 && request.Duration.Duration == 0 && request.Stages == nil {
+				if !stagesValid {
+					continue // The problems of the stages of the test were already reported.
+				}
+				// This request inherits the stages or the duration of the test.
+				request.Stages = test.Stages
+				request.Duration = test.Duration
+			}
+			errs.add(requestPath, request.Validate())
 			if request.FwdCookies {
 				log.Warning("using parent cookies in top request has no effect")
 			}
-			setParentRequest(request, request.Children)
+			errs.add(requestPath, setParentRequest(request, request.Children))
+		}
+		if test.Scenario != nil {
+			errs.add(joinPath(path, "scenario"), test.Scenario.Validate())
+			errs.add(path, validateScenarioRequests(test.Requests))
+		}
+		if test.Mix != nil {
+			if test.Mix.Repeat == 0 && test.Mix.Duration.Duration == 0 {
+				test.Mix.Duration = test.Duration
+			}
+			errs.add(joinPath(path, "mix"), test.Mix.Validate())
 		}
 	}
-	return nil
+	return errs.orNil()
 }
 
 // StressTest stores the one stress test.
 type StressTest struct {
-	Name        string     `xml:"name,attr"`     // Name of this test.
-	Description string     `xml:"description"`   // Description of this test.
-	CriticalTh  Duration   `xml:"critical,attr"` // Duration above the critical level.
-	WarningTh   Duration   `xml:"warning,attr"`  // Duration above the warning level.
-	Requests    []*Request `xml:"request"`       // Top-level requests for this test.
-	Result      []*Result  `xml:"result"`        // Test results, populated only after the tests run.
+	Name        string        `xml:"name,attr" json:"name" yaml:"name"`                                               // Name of this test.
+	Description string        `xml:"description,omitempty" json:"description,omitempty" yaml:"description,omitempty"` // Description of this test.
+	CriticalTh  Duration      `xml:"critical,attr" json:"critical,omitzero" yaml:"critical,omitempty"`                // Duration above the critical level.
+	WarningTh   Duration      `xml:"warning,attr" json:"warning,omitzero" yaml:"warning,omitempty"`                   // Duration above the warning level.
+	Duration    Duration      `xml:"duration,attr" json:"duration,omitzero" yaml:"duration,omitempty"`                // Duration of all top-level requests which do not define a repeat, duration or stages.
+	Stages      Stages        `xml:"stages,omitempty" json:"stages,omitempty" yaml:"stages,omitempty"`                // Load stages of all top-level requests which do not define their own.
+	Scenario    *Scenario     `xml:"scenario" json:"scenario,omitempty" yaml:"scenario,omitempty"`                    // Virtual user scenario which walks the requests, if any.
+	Mix         *Mix          `xml:"mix" json:"mix,omitempty" yaml:"mix,omitempty"`                                   // Weighted mix of requests sharing the same concurrency, if any.
+	Requests    []*Request    `xml:"request" json:"requests,omitempty" yaml:"requests,omitempty"`                     // Top-level requests for this test.
+	SLOs        []*SLO        `xml:"slo" json:"slos,omitempty" yaml:"slos,omitempty"`                                 // Objectives which all the results of this test must meet.
+	Result      []*Result     `xml:"result" json:"-" yaml:"-"`                                                        // Test results, populated only after the tests run.
+	elapsed     time.Duration // Wall time of this test.
 }
 
 func (t StressTest) String() string {
@@ -56,20 +139,24 @@ func (t StressTest) String() string {
 
 // URL handles URL generation based on the requested pattern.
 type URL struct {
-	Base   string      `xml:"base,attr"`
-	Tokens *[]URLToken `xml:"token"`
+	Base   string      `xml:"base,attr" json:"base" yaml:"base"`
+	Tokens *[]URLToken `xml:"token" json:"tokens,omitempty" yaml:"tokens,omitempty"`
 }
 
-// Validate confirms the validity of a URL.
-func (u *URL) Validate() {
+// Validate confirms the validity of a URL, and returns the problems of its tokens as ValidationErrors.
+func (u *URL) Validate() error {
+	errs := ValidationErrors{}
 	if u.Tokens != nil {
-		for _, tok := range *u.Tokens {
-			tok.Validate()
-			if !strings.Contains(u.Base, tok.Token) {
-				panic(fmt.Errorf("cannot find token `%s` in base %s", tok.Token, u.Base))
+		for tno, tok := range *u.Tokens {
+			path := elementPath("", "token", tno+1, tok.Token)
+			if err := tok.Validate(); err != nil {
+				errs.add(path, err)
+			} else if !strings.Contains(u.Base, tok.Token) {
+				errs.add(path, fmt.Errorf("cannot find token `%s` in base %s", tok.Token, u.Base))
 			}
 		}
 	}
+	return errs.orNil()
 }
 
 // Generate returns a new URL based on the base and the tokens.
@@ -96,24 +183,24 @@ func (u URL) String() (url string) {
 
 // URLToken handles the generate of tokens for the URL.
 type URLToken struct {
-	Token   string `xml:"token,attr"`
-	Choices string `xml:"choices,attr"`
-	Pattern string `xml:"pattern,attr"`
-	Min     int    `xml:"min,attr"`
-	Max     int    `xml:"max,attr"`
+	Token   string `xml:"token,attr" json:"token" yaml:"token"`
+	Choices string `xml:"choices,attr,omitempty" json:"choices,omitempty" yaml:"choices,omitempty"`
+	Pattern string `xml:"pattern,attr,omitempty" json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	Min     int    `xml:"min,attr,omitempty" json:"min,omitempty" yaml:"min,omitempty"`
+	Max     int    `xml:"max,attr,omitempty" json:"max,omitempty" yaml:"max,omitempty"`
 }
 
-// Validate checks that the definition of this token is met, and panics otherwise.
-func (t URLToken) Validate() {
+// Validate checks that the definition of this token is met, and returns the first problem otherwise.
+func (t URLToken) Validate() error {
 	if t.Token == "" {
-		panic("empty token in URL definition")
+		return errors.New("empty token in URL definition")
 	}
 	if t.Choices == "" && t.Pattern == "" {
-		panic("URL Token is missing both Choices and Pattern")
+		return errors.New("URL Token is missing both Choices and Pattern")
 	}
 	if t.Choices != "" {
 		if !strings.Contains(t.Choices, "|") {
-			panic(fmt.Errorf("choices %s does not contain any separator (|)", t.Choices))
+			return fmt.Errorf("choices %s does not contain any separator (|)", t.Choices)
 		}
 		if t.Min != 0 || t.Max != 0 {
 			log.Warning("min and max definitions have no effect in URL Tokens of type Choice")
@@ -121,15 +208,16 @@ func (t URLToken) Validate() {
 	}
 	if t.Pattern != "" {
 		if t.Pattern != "num" && t.Pattern != "alpha" && t.Pattern != "alphanum" {
-			panic(fmt.Errorf("unknown pattern %s in URL Token", t.Pattern))
+			return fmt.Errorf("unknown pattern %s in URL Token", t.Pattern)
 		}
 		if t.Min < 0 || t.Max < 0 {
-			panic("min or max is negative in URL Token")
+			return errors.New("min or max is negative in URL Token")
 		}
 		if t.Min > t.Max {
-			panic("min definition is greater than max definition in URL Token")
+			return errors.New("min definition is greater than max definition in URL Token")
 		}
 	}
+	return nil
 }
 
 // Generate returns a new value for a token according to the definition.
@@ -166,10 +254,10 @@ func (t URLToken) String() string {
 
 // Tokenized stores the data handling from a given response.
 type Tokenized struct {
-	Response string `xml:"responseToken,attr"`
-	Header   string `xml:"headerToken,attr"`
-	Cookie   string `xml:"cookieToken,attr"`
-	Data     string `xml:",innerxml"`
+	Response string `xml:"responseToken,attr,omitempty" json:"responseToken,omitempty" yaml:"responseToken,omitempty"`
+	Header   string `xml:"headerToken,attr,omitempty" json:"headerToken,omitempty" yaml:"headerToken,omitempty"`
+	Cookie   string `xml:"cookieToken,attr,omitempty" json:"cookieToken,omitempty" yaml:"cookieToken,omitempty"`
+	Data     string `xml:",innerxml" json:"data,omitempty" yaml:"data,omitempty"`
 }
 
 // IsUsed returns whether this Tokenized will be computed.
@@ -237,44 +325,55 @@ func (t Tokenized) String() string {
 
 // loadProfile loads a profile XML file.
 func loadProfile(profileFile string) error {
-	if profileFile == "" {
-		return errors.New("profile filename is empty")
+	p, err := readProfile(profileFile)
+	if p != nil {
+		profile = p
 	}
-	profileData, err := ioutil.ReadFile(profileFile)
 	if err != nil {
+		if _, invalid := err.(ValidationErrors); invalid {
+			return fmt.Errorf("error loading profile %s:\n%s\n", profileFile, err)
+		}
 		return fmt.Errorf("error loading profile %s: %s\n", profileFile, err)
 	}
-	p := Profile{}
-	if err = xml.Unmarshal(profileData, &p); err != nil {
-		return fmt.Errorf("error loading profile %s: %s\n", profileFile, err)
-	}
-
-	profile = &p
-	if err = p.Validate(); err != nil {
-		return err
-	}
-
 	return nil
 }
 
-// saveResult persists the results as XML.
-func saveResult(profile *Profile, profileFile string) string {
+// saveResult persists the results in the output format(s), and returns the names of the saved files.
+func saveResult(profile *Profile, profileFile string) []string {
 	// Let's move the top result from the request to the StressTest.
 	for _, test := range profile.Tests {
-		test.Result = make([]*Result, len(test.Requests))
-		for i, req := range test.Requests {
+		requests := test.Requests
+		if test.Mix != nil {
+			requests = append(requests, test.Mix.Requests...)
+			test.Mix.Requests = nil
+		}
+		test.Result = make([]*Result, len(requests))
+		for i, req := range requests {
 			req.Result.SetTimeState(test.CriticalTh.Duration, test.WarningTh.Duration)
 			test.Result[i] = req.Result
 		}
 		test.Requests = nil
+		test.EvaluateSLOs()
 	}
+	// The results only keep the outcome of the tests, not how the profile was composed.
+	profile.Includes, profile.Variables, profile.Templates = nil, nil, nil
 
-	content := xmlOutputHeader() + "\n" + xmlOutputStylesheet()
-
-	pContent, _ := xml.MarshalIndent(profile, "", "\t")
-	filename := fmt.Sprintf("%s-%s.xml", strings.Replace(profileFile, ".xml", "", -1), time.Now().Format("2006-01-02_1504"))
-	ioutil.WriteFile(filename, []byte(content+string(pContent)+xmlOutputFooter()), 0644)
-	return filename
+	basename := fmt.Sprintf("%s-%s", strings.TrimSuffix(profileFile, filepath.Ext(profileFile)), time.Now().Format("2006-01-02_1504"))
+	filenames := []string{}
+	if outputFormat == "xml" || outputFormat == "both" {
+		content := xmlOutputHeader() + "\n" + xmlOutputStylesheet()
+		pContent, _ := xml.MarshalIndent(profile, "", "\t")
+		ioutil.WriteFile(basename+".xml", []byte(content+string(pContent)+xmlOutputFooter()), 0644)
+		filenames = append(filenames, basename+".xml")
+	}
+	if outputFormat == "json" || outputFormat == "both" {
+		if err := saveJSONResult(profile, basename+".json"); err != nil {
+			log.Critical("could not save the JSON result: %s", err)
+		} else {
+			filenames = append(filenames, basename+".json")
+		}
+	}
+	return filenames
 }
 
 // xmlOutputHeader the header of the XML result.
@@ -360,6 +459,34 @@ func xmlOutputStylesheet() string {
 					</span>
 					.
 				</p>
+				<xsl:call-template name="slos" />
+				<xsl:if test="scenario">
+					<p class="text-info row">
+						<xsl:value-of
+							select="concat(scenario/@users, ' virtual user(s) completed ', scenario/result/@iterations, ' iteration(s) of the scenario.')" />
+					</p>
+					<h5>Iteration durations</h5>
+					<div class="row">
+						<p class="col-md-10">
+							<table class="table">
+								<tr>
+									<xsl:for-each select="scenario/result/times/*">
+										<th class="text-center">
+											<xsl:value-of select="local-name()" />
+										</th>
+									</xsl:for-each>
+								</tr>
+								<tr>
+									<xsl:for-each select="scenario/result/times/*">
+										<td class="text-center">
+											<xsl:value-of select="@duration" />
+										</td>
+									</xsl:for-each>
+								</tr>
+							</table>
+						</p>
+					</div>
+				</xsl:if>
 				<!-- Generating a table of contents. -->
 				<ul>
 					<xsl:apply-templates select="result" mode="toc" />
@@ -369,6 +496,43 @@ func xmlOutputStylesheet() string {
 			<xsl:apply-templates select="result" mode="detail" />
 		</div>
 	</xsl:template>
+	<xsl:template name="slos">
+		<xsl:if test="slo">
+			<h5>Service level objectives</h5>
+			<div class="row">
+				<p class="col-md-10">
+					<table class="table">
+						<tr>
+							<th class="text-center">Objective</th>
+							<th class="text-center">Actual</th>
+							<th class="text-center">Status</th>
+						</tr>
+						<xsl:for-each select="slo">
+							<tr>
+								<xsl:choose>
+									<xsl:when test="@status='passed'">
+										<xsl:attribute name="class">bg-success</xsl:attribute>
+									</xsl:when>
+									<xsl:otherwise>
+										<xsl:attribute name="class">bg-danger</xsl:attribute>
+									</xsl:otherwise>
+								</xsl:choose>
+								<td class="text-center">
+									<xsl:value-of select="." />
+								</td>
+								<td class="text-center">
+									<xsl:value-of select="@actual" />
+								</td>
+								<td class="text-center">
+									<xsl:value-of select="@status" />
+								</td>
+							</tr>
+						</xsl:for-each>
+					</table>
+				</p>
+			</div>
+		</xsl:if>
+	</xsl:template>
 	<xsl:template match="result|spawned" mode="toc">
 		<li>
 			<a>
@@ -407,9 +571,28 @@ func xmlOutputStylesheet() string {
 
 			</xsl:element>
 			<p class="text-info">
-				<xsl:value-of
-					select="concat(@concurrency, ' concurrent requests repeated ', @repetitions, ' time(s)')" />
+				<xsl:choose>
+					<xsl:when test="@intendedRate">
+						<xsl:value-of
+							select="concat(@repetitions, ' requests at ', format-number(@intendedRate, '0.##'), ' req/s (achieved ', format-number(@achievedRate, '0.##'), ' req/s)')" />
+					</xsl:when>
+					<xsl:when test="@weight">
+						<xsl:value-of
+							select="concat(@repetitions, ' requests (weight ', @weight, ') sent by a mix of ', @concurrency, ' concurrent requests')" />
+					</xsl:when>
+					<xsl:when test="@duration">
+						<xsl:value-of
+							select="concat(@repetitions, ' requests sent by ', @concurrency, ' concurrent requests over ', @duration)" />
+					</xsl:when>
+					<xsl:otherwise>
+						<xsl:value-of
+							select="concat(@concurrency, ' concurrent requests repeated ', @repetitions, ' time(s)')" />
+					</xsl:otherwise>
+				</xsl:choose>
 
+				<xsl:if test="@spawns">
+					<xsl:value-of select="concat(' for each of the ', @spawns, ' parent responses')" />
+				</xsl:if>
 				<xsl:if test="@withCookies='true'">
 					with cookies
 				</xsl:if>
@@ -420,6 +603,7 @@ func xmlOutputStylesheet() string {
 					with request body
 				</xsl:if>
 			</p>
+			<xsl:call-template name="slos" />
 			<h5>Status summary</h5>
 			<div class="row">
 				<p class="col-md-10">
@@ -465,7 +649,52 @@ func xmlOutputStylesheet() string {
 					</table>
 				</p>
 			</div>
-			<h5>Response times</h5>
+			<xsl:if test="assertions">
+				<h5>Assertions</h5>
+				<div class="row">
+					<p class="col-md-10">
+						<xsl:choose>
+							<xsl:when test="assertions/@failed>0">
+								<xsl:attribute name="class">col-md-10 text-danger</xsl:attribute>
+							</xsl:when>
+							<xsl:otherwise>
+								<xsl:attribute name="class">col-md-10 text-success</xsl:attribute>
+							</xsl:otherwise>
+						</xsl:choose>
+						<xsl:value-of
+							select="concat(assertions/@passed, ' response(s) passed and ', assertions/@failed, ' response(s) failed the assertions.')" />
+					</p>
+				</div>
+				<xsl:if test="assertions/failure">
+					<div class="row">
+						<p class="col-md-10">
+							<table class="table">
+								<tr>
+									<th class="text-center">Check</th>
+									<th class="text-center">Failures</th>
+									<th class="text-center">Sample</th>
+								</tr>
+								<xsl:for-each select="assertions/failure">
+									<tr>
+										<td class="text-center">
+											<xsl:value-of select="@check" />
+										</td>
+										<td class="text-danger text-center">
+											<xsl:value-of select="@count" />
+										</td>
+										<td class="text-center">
+											<xsl:value-of select="@sample" />
+										</td>
+									</tr>
+								</xsl:for-each>
+							</table>
+						</p>
+					</div>
+				</xsl:if>
+			</xsl:if>
+			<h5>
+				<xsl:value-of select="concat('Response times (', times/@count, ' samples)')" />
+			</h5>
 			<div class="row">
 				<p class="col-md-6">
 					<table class="table">
@@ -550,6 +779,101 @@ func xmlOutputStylesheet() string {
 					</table>
 				</p>
 			</div>
+			<xsl:if test="timeseries/bucket">
+				<h5>
+					<xsl:value-of select="concat('Time series (', timeseries/@interval, ' buckets)')" />
+				</h5>
+				<div class="row">
+					<p class="col-md-10">
+						<table class="table table-hover">
+							<tr>
+								<th class="text-center">Offset</th>
+								<th class="text-center">Requests</th>
+								<th class="text-center">Errors</th>
+								<th class="text-center">mean</th>
+								<xsl:for-each select="timeseries/bucket[1]/times/*[starts-with(local-name(), 'p')]">
+									<th class="text-center">
+										<xsl:value-of select="local-name()" />
+									</th>
+								</xsl:for-each>
+								<th class="text-center">longest</th>
+							</tr>
+							<xsl:for-each select="timeseries/bucket">
+								<tr>
+									<td class="text-center">
+										<xsl:choose>
+											<xsl:when test="@offset">
+												<xsl:value-of select="@offset" />
+											</xsl:when>
+											<xsl:otherwise>0s</xsl:otherwise>
+										</xsl:choose>
+									</td>
+									<td class="text-info text-center">
+										<xsl:value-of select="@requests" />
+									</td>
+									<td>
+										<xsl:choose>
+											<xsl:when test="@errors>0">
+												<xsl:attribute name="class">text-danger text-center</xsl:attribute>
+											</xsl:when>
+											<xsl:otherwise>
+												<xsl:attribute name="class">text-success text-center</xsl:attribute>
+											</xsl:otherwise>
+										</xsl:choose>
+										<xsl:value-of select="@errors" />
+									</td>
+									<xsl:for-each select="times/mean|times/*[starts-with(local-name(), 'p')]|times/longest">
+										<td>
+											<xsl:choose>
+												<xsl:when test="@state='nominal'">
+													<xsl:attribute name="class">bg-success text-center</xsl:attribute>
+												</xsl:when>
+												<xsl:when test="@state='warning'">
+													<xsl:attribute name="class">bg-warning text-center</xsl:attribute>
+												</xsl:when>
+												<xsl:when test="@state='critical'">
+													<xsl:attribute name="class">bg-danger text-center</xsl:attribute>
+												</xsl:when>
+												<xsl:otherwise>
+													<xsl:attribute name="class">text-center</xsl:attribute>
+												</xsl:otherwise>
+											</xsl:choose>
+											<xsl:value-of select="@duration" />
+										</td>
+									</xsl:for-each>
+								</tr>
+							</xsl:for-each>
+						</table>
+					</p>
+				</div>
+			</xsl:if>
+			<h5>Timing breakdown</h5>
+			<div class="row">
+				<p class="col-md-10">
+					<table class="table">
+						<tr>
+							<th class="text-center">Phase</th>
+							<xsl:for-each select="phases/ttfb/*">
+								<th class="text-center">
+									<xsl:value-of select="local-name()" />
+								</th>
+							</xsl:for-each>
+						</tr>
+						<xsl:for-each select="phases/*">
+							<tr>
+								<th class="text-center">
+									<xsl:value-of select="local-name()" />
+								</th>
+								<xsl:for-each select="*">
+									<td class="text-center">
+										<xsl:value-of select="@duration" />
+									</td>
+								</xsl:for-each>
+							</tr>
+						</xsl:for-each>
+					</table>
+				</p>
+			</div>
 			<h5>Status breakdown</h5>
 			<div class="row">
 				<p class="col-md-3">
@@ -575,6 +899,73 @@ func xmlOutputStylesheet() string {
 					</table>
 				</p>
 			</div>
+			<xsl:if test="stage">
+				<h5>Stages</h5>
+				<div class="row">
+					<p class="col-md-10">
+						<table class="table table-hover">
+							<thead>
+								<tr>
+									<th class="text-center">Stage</th>
+									<th class="text-center">Concurrency</th>
+									<th class="text-center">Requests</th>
+									<th class="text-center">Errored</th>
+									<th class="text-center">2xx</th>
+									<th class="text-center">4xx</th>
+									<th class="text-center">5xx</th>
+									<th class="text-center">Median</th>
+									<th class="text-center">p95</th>
+									<th class="text-center">p99</th>
+									<th class="text-center">Longest</th>
+								</tr>
+							</thead>
+							<tbody>
+								<xsl:for-each select="stage">
+									<tr>
+										<td class="text-center">
+											<xsl:value-of select="concat('#', position(), ' ', @mode, ' over ', @duration)" />
+										</td>
+										<td class="text-center">
+											<xsl:value-of select="@target" />
+										</td>
+										<td class="text-center">
+											<xsl:value-of select="@requests" />
+										</td>
+										<td class="text-center">
+											<xsl:value-of select="statuses/@errored" />
+										</td>
+										<td class="text-center">
+											<xsl:value-of select="statuses/@s2xx" />
+										</td>
+										<td class="text-center">
+											<xsl:value-of select="statuses/@s4xx" />
+										</td>
+										<td class="text-center">
+											<xsl:value-of select="statuses/@s5xx" />
+										</td>
+										<xsl:for-each select="times/p50|times/p95|times/p99|times/longest">
+											<td>
+												<xsl:choose>
+													<xsl:when test="@state='warning'">
+														<xsl:attribute name="class">bg-warning text-center</xsl:attribute>
+													</xsl:when>
+													<xsl:when test="@state='critical'">
+														<xsl:attribute name="class">bg-danger text-center</xsl:attribute>
+													</xsl:when>
+													<xsl:otherwise>
+														<xsl:attribute name="class">bg-success text-center</xsl:attribute>
+													</xsl:otherwise>
+												</xsl:choose>
+												<xsl:value-of select="@duration" />
+											</td>
+										</xsl:for-each>
+									</tr>
+								</xsl:for-each>
+							</tbody>
+						</table>
+					</p>
+				</div>
+			</xsl:if>
 			<xsl:apply-templates select="spawned" mode="detail" />
 		</div>
 	</xsl:template>
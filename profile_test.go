@@ -23,45 +23,45 @@ func TestURL(t *testing.T) {
 			xml.Unmarshal([]byte(`<url base="http://example.org:7789/stress/PUT" />`), &out)
 			So(out.Generate(), ShouldEqual, "http://example.org:7789/stress/PUT")
 			So(out.String(), ShouldEqual, "http://example.org:7789/stress/PUT")
-			So(out.Tokens, ShouldEqual, nil)
+			So(out.Tokens, ShouldBeNil)
 		})
 
 		Convey("Invalid tokens", func() {
 			Convey("Choices have no separator should fail validation", func() {
 				u := URLToken{Choices: "Val1Val2", Token: "test"}
-				So(u.Validate, ShouldPanic)
+				So(u.Validate(), ShouldNotBeNil)
 			})
 			Convey("Choices have a min and max", func() {
 				u := URLToken{Choices: "Val1|Val2", Token: "test", Min: 1}
-				So(u.Validate, ShouldNotPanic)
+				So(u.Validate(), ShouldBeNil)
 				u = URLToken{Choices: "Val1|Val2", Token: "test", Max: 1}
-				So(u.Validate, ShouldNotPanic)
+				So(u.Validate(), ShouldBeNil)
 				u = URLToken{Choices: "Val1|Val2", Token: "test", Min: 1, Max: 2}
-				So(u.Validate, ShouldNotPanic)
+				So(u.Validate(), ShouldBeNil)
 			})
 			Convey("Token is not defined", func() {
 				u := URLToken{}
-				So(u.Validate, ShouldPanic)
+				So(u.Validate(), ShouldNotBeNil)
 			})
 			Convey("Choices and pattern not defined", func() {
 				u := URLToken{Token: "test"}
-				So(u.Validate, ShouldPanic)
+				So(u.Validate(), ShouldNotBeNil)
 			})
 			Convey("Pattern does not exist", func() {
 				u := URLToken{Pattern: "Val1Val2", Token: "test"}
-				So(u.Validate, ShouldPanic)
+				So(u.Validate(), ShouldNotBeNil)
 			})
 			Convey("Min is greater than max", func() {
 				u := URLToken{Pattern: "alpha", Min: 10, Max: 5, Token: "test"}
-				So(u.Validate, ShouldPanic)
+				So(u.Validate(), ShouldNotBeNil)
 			})
 			Convey("Min and max are negative", func() {
 				u := URLToken{Pattern: "alpha", Min: -10, Max: 5, Token: "test"}
-				So(u.Validate, ShouldPanic)
+				So(u.Validate(), ShouldNotBeNil)
 				u = URLToken{Pattern: "alpha", Min: 10, Max: -5, Token: "test"}
-				So(u.Validate, ShouldPanic)
+				So(u.Validate(), ShouldNotBeNil)
 				u = URLToken{Pattern: "alpha", Min: 10, Max: -5, Token: "test"}
-				So(u.Validate, ShouldPanic)
+				So(u.Validate(), ShouldNotBeNil)
 			})
 		})
 
@@ -76,7 +76,7 @@ func TestURL(t *testing.T) {
 			xml.Unmarshal([]byte(example), &out)
 			So(out.Tokens, ShouldNotEqual, nil)
 			for _, tok := range *out.Tokens {
-				So(tok.Validate, ShouldNotPanic)
+				So(tok.Validate(), ShouldBeNil)
 				switch tok.Token {
 				case "token1":
 					So(tok.Choices, ShouldEqual, "Val1|Val2")
@@ -117,7 +117,7 @@ func TestURL(t *testing.T) {
 					So(tok.Generate(), ShouldNotEqual, tok.Generate())
 				}
 			}
-			So(out.Validate, ShouldNotPanic)
+			So(out.Validate(), ShouldBeNil)
 			pattern := "http://example.org:1598/expensive/(Val1|Val2)-[A-Za-z]{5,10}/[0-9]{1,4}/[A-Za-z0-9]{5,10}"
 			matched, err := regexp.MatchString(pattern, out.Generate())
 			So(err, ShouldEqual, nil)
@@ -125,18 +125,18 @@ func TestURL(t *testing.T) {
 			So(out.String(), ShouldEqual, pattern)
 		})
 
-		Convey("Non existing tokens should panic", func() {
+		Convey("Non existing tokens should fail validation", func() {
 			example := `<url base="http://example.org:1598/expensive/ToKeN1/">
 					<token token="token1" choices="Val1|Val2" /></url>`
 			out := URL{}
 			xml.Unmarshal([]byte(example), &out)
 			So(out.Tokens, ShouldNotEqual, nil)
 			for _, tok := range *out.Tokens {
-				// The token is valid so it should not panic.
-				So(tok.Validate, ShouldNotPanic)
+				// The token itself is valid.
+				So(tok.Validate(), ShouldBeNil)
 			}
 			// However, if the token is not found in the URL, its validation should fail.
-			So(out.Validate, ShouldPanic)
+			So(out.Validate(), ShouldNotBeNil)
 
 		})
 	})
@@ -249,6 +249,28 @@ func TestTokenized(t *testing.T) {
 }
 
 func TestProfileConstraints(t *testing.T) {
+	Convey("Profile validation should propagate the test duration", t, func() {
+		profileData := `<?xml version="1.0" encoding="UTF-8"?>
+		<sg name="Basic example" uid="1">
+			<test name="SG test" critical="1s" warning="750ms" duration="10m">
+				<request method="get" concurrency="10">
+					<url base="http://google.com/search" />
+					<request method="get" repeat="10" concurrency="10">
+						<url base="http://google.com/search" />
+					</request>
+				</request>
+				<request method="get" repeat="20" concurrency="10">
+					<url base="http://google.com/search" />
+				</request>
+			</test>
+		</sg>`
+		profile := Profile{}
+		xml.Unmarshal([]byte(profileData), &profile)
+		So(profile.Validate(), ShouldBeNil)
+		So(profile.Tests[0].Requests[0].Duration.Duration, ShouldEqual, time.Minute*10)
+		So(profile.Tests[0].Requests[0].Children[0].Duration.Duration, ShouldEqual, 0)
+		So(profile.Tests[0].Requests[1].Duration.Duration, ShouldEqual, 0)
+	})
 	Convey("Profile validation should not be nominal", t, func() {
 		Convey("there are no tests", func() {
 			profileData := `<?xml version="1.0" encoding="UTF-8"?><sg name="Basic example" uid="1"><test name="Profile test" critical="1s" warning="750ms"/></sg>`
@@ -256,6 +278,38 @@ func TestProfileConstraints(t *testing.T) {
 			xml.Unmarshal([]byte(profileData), &profile)
 			So(profile.Validate(), ShouldNotBeNil)
 		})
+		Convey("the precision is out of range", func() {
+			profileData := `<?xml version="1.0" encoding="UTF-8"?><sg name="Basic example" uid="1" precision="6"><test name="Profile test" critical="1s" warning="750ms"><request method="get" repeat="1" concurrency="1"><url base="http://google.com/search" /></request></test></sg>`
+			profile := Profile{}
+			xml.Unmarshal([]byte(profileData), &profile)
+			So(profile.Validate(), ShouldNotBeNil)
+		})
+		Convey("the percentiles are invalid", func() {
+			profileData := `<?xml version="1.0" encoding="UTF-8"?><sg name="Basic example" uid="1" percentiles="50,100"><test name="Profile test" critical="1s" warning="750ms"><request method="get" repeat="1" concurrency="1"><url base="http://google.com/search" /></request></test></sg>`
+			profile := Profile{}
+			xml.Unmarshal([]byte(profileData), &profile)
+			So(profile.Validate(), ShouldNotBeNil)
+		})
+		Convey("the interval is negative", func() {
+			profileData := `<?xml version="1.0" encoding="UTF-8"?><sg name="Basic example" uid="1" interval="-1s"><test name="Profile test" critical="1s" warning="750ms"><request method="get" repeat="1" concurrency="1"><url base="http://google.com/search" /></request></test></sg>`
+			profile := Profile{}
+			xml.Unmarshal([]byte(profileData), &profile)
+			So(profile.Validate(), ShouldNotBeNil)
+		})
+		Convey("a test has both stages and a duration", func() {
+			profileData := `<?xml version="1.0" encoding="UTF-8"?>
+			<sg name="Basic example" uid="1">
+				<test name="SG test" critical="1s" warning="750ms" duration="1m">
+					<stages><stage duration="1m" target="10" /></stages>
+					<request method="get" concurrency="10">
+						<url base="http://google.com/search" />
+					</request>
+				</test>
+			</sg>`
+			profile := Profile{}
+			xml.Unmarshal([]byte(profileData), &profile)
+			So(profile.Validate(), ShouldNotBeNil)
+		})
 		Convey("there cookie forwaring is enabled on top request", func() {
 			profileData := `<?xml version="1.0" encoding="UTF-8"?>
 			<sg name="Basic example" uid="1">
@@ -2,11 +2,14 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"runtime"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/franela/goreq"
@@ -15,43 +18,159 @@ import (
 // Request stores the request as XML.
 // It is kept in XML until it is executed to read from the parent response as needed.
 type Request struct {
-	Parent      *Request       // Parent of this request, can be nil.
-	Children    []*Request     `xml:"request"`               // Children of this request.
-	Method      string         `xml:"method,attr"`           // Method of this request.
-	Repeat      int            `xml:"repeat,attr"`           // Number of times to repeat this request.
-	Concurrency int            `xml:"concurrency,attr"`      // Number of concurrent requests like these to send.
-	RespType    string         `xml:"responseType,attr"`     // Response type which can be used for child requests.
-	FwdCookies  bool           `xml:"useParentCookies,attr"` // Forward the parent response cookies to the children requests.
-	URL         *URL           `xml:"url"`                   // URL to request.
-	Headers     *Tokenized     `xml:"headers"`               // Headers to send.
-	Data        *Tokenized     `xml:"data"`                  // Data to send.
-	Result      *Result        `xml:"result"`
-	ongoingReqs chan struct{}  // Channel of ongoing requests.
-	doneChan    chan *Response // Channel of responses to buffer them prior to transferring them to doneReqs.
-	doneReqs    []*Response    // List of responses.
-	doneWg      sync.WaitGroup // Wait group of the completed requests.
+	Parent        *Request           `xml:"-" json:"-" yaml:"-"`                                                                                 // Parent of this request, can be nil.
+	Method        string             `xml:"method,attr,omitempty" json:"method,omitempty" yaml:"method,omitempty"`                               // Method of this request.
+	Use           string             `xml:"use,attr,omitempty" json:"use,omitempty" yaml:"use,omitempty"`                                        // Name of the template from which this request takes the fields it does not define.
+	Repeat        int                `xml:"repeat,attr,omitempty" json:"repeat,omitempty" yaml:"repeat,omitempty"`                               // Number of times to repeat this request.
+	Concurrency   int                `xml:"concurrency,attr,omitempty" json:"concurrency,omitempty" yaml:"concurrency,omitempty"`                // Number of concurrent requests like these to send.
+	Rate          Rate               `xml:"rate,attr" json:"rate,omitzero" yaml:"rate,omitempty"`                                                // Arrival rate at which to start requests (open model), e.g. 200/s.
+	Duration      Duration           `xml:"duration,attr" json:"duration,omitzero" yaml:"duration,omitempty"`                                    // Duration during which to send requests, at the given rate or concurrency.
+	Stages        Stages             `xml:"stages,omitempty" json:"stages,omitempty" yaml:"stages,omitempty"`                                    // Load stages during which the concurrency is adjusted live.
+	RespType      string             `xml:"responseType,attr,omitempty" json:"responseType,omitempty" yaml:"responseType,omitempty"`             // Response type which can be used for child requests.
+	FwdCookies    bool               `xml:"useParentCookies,attr,omitempty" json:"useParentCookies,omitempty" yaml:"useParentCookies,omitempty"` // Forward the parent response cookies to the children requests.
+	SpawnChildren string             `xml:"spawnChildren,attr,omitempty" json:"spawnChildren,omitempty" yaml:"spawnChildren,omitempty"`          // Either once (default) from the first response, or for each response.
+	Weight        int                `xml:"weight,attr,omitempty" json:"weight,omitempty" yaml:"weight,omitempty"`                               // Weight of this request when part of a mix.
+	URL           *URL               `xml:"url" json:"url,omitempty" yaml:"url,omitempty"`                                                       // URL to request.
+	Headers       *Tokenized         `xml:"headers" json:"headers,omitempty" yaml:"headers,omitempty"`                                           // Headers to send.
+	Data          *Tokenized         `xml:"data" json:"data,omitempty" yaml:"data,omitempty"`                                                    // Data to send.
+	Assert        *ResponseAssertion `xml:"assert" json:"assert,omitempty" yaml:"assert,omitempty"`                                              // Checks which each response must pass.
+	SLOs          []*SLO             `xml:"slo" json:"slos,omitempty" yaml:"slos,omitempty"`                                                     // Objectives which the result of this request must meet.
+	Children      []*Request         `xml:"request" json:"requests,omitempty" yaml:"requests,omitempty"`                                         // Children of this request.
+	Result        *Result            `xml:"result" json:"-" yaml:"-"`
+	ongoingReqs   chan struct{}      // Channel of ongoing requests.
+	doneChan      chan *Response     // Channel of responses to buffer them prior to aggregating them.
+	firstResp     *Response          // First response, used as the parent response of the children spawned once.
+	agg           *aggregator        // Statistics of all the responses.
+	aggMutex      sync.Mutex         // Guards the statistics, which the dashboard reads while they are aggregated.
+	stageAggs     []*aggregator      // Statistics of the responses of each stage, if any.
+	doneWg        sync.WaitGroup     // Wait group of the completed requests.
+	stage         int32              // Index of the ongoing stage, if any.
+	runs          int32              // Number of times the requests were sent, i.e. once per parent response if spawned for each.
+	sent          int64              // Number of requests sent by the workers of requests without a repeat, e.g. with stages.
+	inFlight      int32              // Number of requests sent which did not complete yet, however they were sent.
+	collectOnce   sync.Once          // Ensures a single go routine collects the responses.
 }
 
 // Validate confirms that a request is correctly defined and initializes variables.
-func (r *Request) Validate() {
-	if r.Concurrency > r.Repeat {
-		panic(fmt.Errorf("concurrency of %d for %d repetitions does not make sense", r.Concurrency, r.Repeat))
+// It returns all the problems of the request, but not of its children, as ValidationErrors.
+func (r *Request) Validate() error {
+	errs := ValidationErrors{}
+	if r.Repeat < 0 {
+		errs.add("", fmt.Errorf("repeat of %d is negative", r.Repeat))
+	}
+	if r.Concurrency < 0 {
+		errs.add("", fmt.Errorf("concurrency of %d is negative", r.Concurrency))
+	}
+	if r.Stages != nil {
+		if r.Rate.IsSet() {
+			errs.add("", errors.New("stages cannot be combined with a rate"))
+		}
+		if r.Duration.Duration > 0 {
+			errs.add("", errors.New("stages cannot be combined with a duration"))
+		}
+		if r.Repeat != 0 {
+			log.Warning("repeat definition has no effect on requests with stages")
+			r.Repeat = 0
+		}
+		for sno, stage := range r.Stages {
+			errs.add(elementPath("stages", "stage", sno+1, ""), stage.Validate())
+		}
+	} else if r.Rate.IsSet() {
+		if r.Repeat == 0 {
+			if r.Duration.Duration <= 0 {
+				errs.add("", fmt.Errorf("rate of %s requires either a repeat or a duration", r.Rate))
+			} else if r.Repeat = int(r.Rate.PerSecond() * r.Duration.Duration.Seconds()); r.Repeat == 0 {
+				errs.add("", fmt.Errorf("rate of %s over %s does not send any request", r.Rate, r.Duration))
+			}
+		}
+		if r.Concurrency == 0 {
+			// In an open model, the number of in-flight requests is not limited by default.
+			r.Concurrency = r.Repeat
+		}
+	} else if r.Duration.Duration > 0 {
+		if r.Concurrency <= 0 {
+			errs.add("", fmt.Errorf("duration of %s requires a concurrency", r.Duration))
+		}
+		if r.Repeat != 0 {
+			log.Warning("repeat definition has no effect on requests with a duration")
+			r.Repeat = 0
+		}
+	}
+	if !r.isTimed() && r.Concurrency > r.Repeat {
+		errs.add("", fmt.Errorf("concurrency of %d for %d repetitions does not make sense", r.Concurrency, r.Repeat))
 	}
 	if r.Method == "" {
-		panic("method not defined")
+		errs.add("", errors.New("method not defined"))
+	}
+	if r.SpawnChildren == "" {
+		r.SpawnChildren = "once"
+	}
+	if r.SpawnChildren != "once" && r.SpawnChildren != "each" {
+		errs.add("", fmt.Errorf("spawnChildren `%s` is not supported", r.SpawnChildren))
 	}
 	if r.RespType != "" && r.RespType != "json" {
-		panic(fmt.Errorf("reponseType `%s` is not yet supported", r.RespType))
+		errs.add("", fmt.Errorf("reponseType `%s` is not yet supported", r.RespType))
 	}
 	r.Method = strings.ToUpper(r.Method)
-	r.URL.Validate()
+	if r.URL == nil {
+		errs.add("", errors.New("url not defined"))
+	} else {
+		errs.add("url", r.URL.Validate())
+	}
+	if r.Assert != nil {
+		errs.add("assert", r.Assert.Validate())
+	}
+	for sno, slo := range r.SLOs {
+		errs.add(elementPath("", "slo", sno+1, ""), slo.Validate())
+	}
+	if len(errs) > 0 {
+		return errs
+	}
 	r.ongoingReqs = make(chan struct{}, r.Concurrency)
-	r.doneReqs = make([]*Response, 0)
+	r.agg = newSeriesAggregator()
+	if r.Stages != nil {
+		r.stageAggs = make([]*aggregator, len(r.Stages))
+		for sno := range r.Stages {
+			r.stageAggs[sno] = newAggregator()
+		}
+	}
 	r.doneChan = make(chan *Response, r.Repeat)
+	return nil
 }
 
-// Spawn sends the actual request.
+// Spawn sends the actual request, and computes its result once all the responses are in.
 func (r *Request) Spawn(parent *Response, wg *sync.WaitGroup) {
+	wg.Add(1) // Holds the wait group until the result is computed.
+	r.run(parent, wg)
+	go r.finish(wg)
+}
+
+// run sends the requests using the provided parent response. Children spawned for each
+// response call this several times, and all the responses are gathered in the same list.
+func (r *Request) run(parent *Response, wg *sync.WaitGroup) {
+	greq := r.prepare(parent)
+
+	// One go routine which pops responses from the channel and moves them to the list.
+	r.collectOnce.Do(func() { go r.collect(wg) })
+
+	// Let's spawn all the requests, with their respective concurrency.
+	atomic.AddInt32(&r.runs, 1)
+	wg.Add(r.Repeat)
+	r.doneWg.Add(r.Repeat)
+	if r.isTimed() {
+		r.doneWg.Add(1) // Holds the completion until all the stages are over.
+		go r.runStages(greq, wg)
+	} else if r.Rate.IsSet() {
+		go r.schedule(greq)
+	} else {
+		for rno := 1; rno <= r.Repeat; rno++ {
+			go r.send(rno, greq, time.Time{})
+		}
+	}
+}
+
+// prepare returns the request to send, with the body, headers and cookies set from the parent response.
+func (r *Request) prepare(parent *Response) goreq.Request {
 	body := ""
 	if r.Data != nil {
 		body = r.Data.Format(parent)
@@ -76,153 +195,247 @@ func (r *Request) Spawn(parent *Response, wg *sync.WaitGroup) {
 			}
 		}
 	}
+	return greq
+}
 
-	// One go routine which pops responses from the channel and moves them to the list.
-	go func() {
-		for {
-			r.doneReqs = append(r.doneReqs, <-r.doneChan)
-			r.doneWg.Done()
-			perc := float64(len(r.doneReqs)) / float64(r.Repeat)
-			notify := false
-			if perc >= 0.75 && perc-0.75 < 1e-4 {
-				notify = true
-			} else if perc >= 0.5 && perc-0.5 < 1e-4 {
-				notify = true
-			} else if perc >= 0.25 && perc-0.25 < 1e-4 {
-				notify = true
-			} else if len(r.doneReqs)%100 == 0 {
-				notify = true
+// collect pops responses from the channel and aggregates them. If children are spawned for
+// each response, their requests are sent before the response is marked as done.
+func (r *Request) collect(wg *sync.WaitGroup) {
+	for {
+		resp := <-r.doneChan
+		if r.firstResp == nil {
+			r.firstResp = resp
+		}
+		r.aggMutex.Lock()
+		r.agg.add(resp)
+		if r.stageAggs != nil {
+			r.stageAggs[resp.stage].add(resp)
+		}
+		r.aggMutex.Unlock()
+		// Logging under the lock could deadlock with the dashboard, which logs under its own lock
+		// and takes this one to render.
+		if resp.statusCode != -1 && (resp.statusCode < 100 || resp.statusCode > 599) {
+			log.Warning("Unsupported status code %d received.", resp.statusCode)
+		}
+		if metrics != nil {
+			metrics.observe(r, resp)
+		}
+		if streamer != nil {
+			streamer.observe(r, resp)
+		}
+		if r.SpawnChildren == "each" {
+			for _, child := range r.Children {
+				child.run(resp, wg)
 			}
-			if notify {
-				log.Notice("Completed %d requests out of %d to %s.", len(r.doneReqs), r.Repeat, r.URL)
+		}
+		wg.Done()
+		r.doneWg.Done()
+		if dashboard != nil {
+			continue // The dashboard already shows the progress.
+		}
+		done := r.agg.count
+		expected := r.Repeat * int(atomic.LoadInt32(&r.runs))
+		perc := float64(done) / float64(expected)
+		notify := false
+		if perc >= 0.75 && perc-0.75 < 1e-4 {
+			notify = true
+		} else if perc >= 0.5 && perc-0.5 < 1e-4 {
+			notify = true
+		} else if perc >= 0.25 && perc-0.25 < 1e-4 {
+			notify = true
+		} else if done%100 == 0 {
+			notify = true
+		}
+		if notify {
+			if r.Stages != nil {
+				log.Notice("Completed %d of %d sent requests to %s (stage #%d).", done, atomic.LoadInt64(&r.sent), r.URL, atomic.LoadInt32(&r.stage)+1)
+			} else if expected == 0 {
+				log.Notice("Completed %d of %d sent requests to %s.", done, atomic.LoadInt64(&r.sent), r.URL)
+			} else {
+				log.Notice("Completed %d requests out of %d to %s.", done, expected, r.URL)
 			}
 		}
-	}()
+	}
+}
 
-	// Let's spawn all the requests, with their respective concurrency.
-	wg.Add(r.Repeat)
-	r.doneWg.Add(r.Repeat)
-	for rno := 1; rno <= r.Repeat; rno++ {
-		go func(no int, greq goreq.Request) {
-			r.ongoingReqs <- struct{}{} // Adding sentinel value to limit concurrency.
-			greq.Uri = r.URL.Generate()
-			resp := Response{}
-
-			startTime := time.Now()
-			gresp, err := greq.Do()
-			resp.FromGoResp(gresp, err, startTime)
-			if err != nil {
-				log.Critical("could not send request to #%d %s: %s", no, r.URL, err)
-			}
+// finish waits for all the requests to complete, spawns the children if needed and computes
+// the result. It then waits for the children to finish. This releases one hold on the wait group.
+func (r *Request) finish(wg *sync.WaitGroup) {
+	r.doneWg.Wait()
 
-			<-r.ongoingReqs // We're done, let's make room for the next request.
-			resp.duration = time.Since(startTime)
-			// Let's add that request to the list of completed requests.
-			r.doneChan <- &resp
-			runtime.Gosched()
-		}(rno, greq)
+	if r.Children != nil && r.SpawnChildren != "each" {
+		log.Debug("Spawning children for %s.", r.URL)
+		for _, child := range r.Children {
+			// Note that we always use the FIRST response as the parent response.
+			child.run(r.firstResp, wg)
+		}
 	}
+	log.Debug("Computing result of %s.", r.URL)
+	r.ComputeResult(wg)
+	// The result of this request must be computed before those of its children.
+	for _, child := range r.Children {
+		wg.Add(1)
+		go child.finish(wg)
+	}
+	// Let's now unset the children because we don't need them anymore.
+	r.Children = nil
+	wg.Done()
+}
 
-	// Let's now have a go routine which waits for all the requests to complete
-	// and spawns all the children.
-	go func() {
-		r.doneWg.Wait()
+// schedule starts the requests on a fixed arrival clock as defined by the rate.
+// Requests are started at their intended time regardless of how long the previous ones take.
+func (r *Request) schedule(greq goreq.Request) {
+	interval := r.Rate.Interval()
+	start := time.Now()
+	for rno := 1; rno <= r.Repeat; rno++ {
+		intended := start.Add(time.Duration(rno-1) * interval)
+		time.Sleep(intended.Sub(time.Now()))
+		go r.send(rno, greq, intended)
+	}
+}
 
-		if r.Children != nil {
-			log.Debug("Spawning children for %s.", r.URL)
-			for _, child := range r.Children {
-				// Note that we always use the LAST response as the parent response.
-				child.Spawn(r.doneReqs[0], wg)
-			}
-		}
-		log.Debug("Computing result of %s.", r.URL)
-		r.ComputeResult(wg)
-	}()
+// send executes the request and adds its response to the list of completed requests.
+// If the intended start time is set, the duration is measured from that time in order
+// to account for any time spent waiting to be sent (i.e. avoids coordinated omission).
+func (r *Request) send(no int, greq goreq.Request, intended time.Time) {
+	r.ongoingReqs <- struct{}{} // Adding sentinel value to limit concurrency.
+	resp := r.do(no, greq, intended, r.URL.Generate())
+	<-r.ongoingReqs // We're done, let's make room for the next request.
+	// Let's add that request to the list of completed requests.
+	r.doneChan <- resp
+	runtime.Gosched()
+}
+
+// do executes the request to the given URI and returns its response, timed from the intended start time if set.
+func (r *Request) do(no int, greq goreq.Request, intended time.Time, uri string) *Response {
+	greq.Uri = uri
+	resp := Response{stage: int(atomic.LoadInt32(&r.stage))}
+
+	timing := &Timing{}
+	greq.OnBeforeRequest = timing.hook
+	startTime := time.Now()
+	if intended.IsZero() {
+		intended = startTime
+	}
+	atomic.AddInt32(&r.inFlight, 1)
+	gresp, err := greq.Do()
+	atomic.AddInt32(&r.inFlight, -1)
+	resp.FromGoResp(gresp, err, startTime)
+	resp.timing = timing.finish()
+	if body, ok := greq.Body.(string); ok {
+		resp.sent = int64(len(body))
+	}
+	resp.uri = uri
+	if err != nil {
+		log.Critical("could not send request to #%d %s: %s", no, r.URL, err)
+		resp.err = err.Error()
+	}
+	resp.duration = time.Since(intended)
+	if r.Assert != nil && resp.statusCode != -1 {
+		resp.asserted = true
+		resp.failures = r.Assert.Check(&resp, resp.body)
+	}
+	resp.body = nil // The body is no longer needed.
+	return &resp
 }
 
 // ComputeResult computes the results for the given request.
 func (r *Request) ComputeResult(wg *sync.WaitGroup) {
-	wg.Add(1) // Make sure this blocks output generation until we complete computation (sharing the WG with the request).
-	times := []time.Duration{}
-	statuses := make(map[int]Status)
-	summary := StatusSummary{}
-	for _, response := range r.doneReqs {
-		totalSentRequests++
-		times = append(times, response.duration)
-		if response.statusCode == -1 {
-			// An error occurred when executing this request.
-			summary.None++
-		} else {
-			if val, exists := statuses[response.statusCode]; exists {
-				val.Count++
-				statuses[response.statusCode] = val
-			} else {
-				statuses[response.statusCode] = Status{Code: response.statusCode, Count: 1}
-			}
-			switch response.statusCode / 100 {
-			case 1:
-				summary.S1xx++
-			case 2:
-				summary.S2xx++
-			case 3:
-				summary.S3xx++
-			case 4:
-				summary.S4xx++
-			case 5:
-				summary.S5xx++
-			default:
-				log.Warning("Unsupported status code %d received.", response.statusCode)
-			}
-		}
-		wg.Done()
-	}
+	wg.Add(1)                                               // Make sure this blocks output generation until we complete computation (sharing the WG with the request).
+	atomic.AddInt64(&totalSentRequests, int64(r.agg.count)) // The results of sibling requests are computed concurrently.
 	// Let's aggregate all this in a Result object.
-	result := Result{Method: r.Method, URL: r.URL.String(), Concurrency: r.Concurrency, Repetitions: r.Repeat,
+	result := Result{Method: r.Method, URL: r.URL.String(), Concurrency: r.Concurrency, Repetitions: r.repetitions(), Weight: r.Weight,
 		HadCookies: r.FwdCookies,
 		HadData:    r.Data != nil && r.Data.IsUsed(),
 		HadHeader:  r.Headers != nil && r.Headers.IsUsed(),
-		StatusSum:  &summary,
-		Times:      NewPercentages(times),
+		StatusSum:  r.agg.Summary(),
+		Statuses:   r.agg.Statuses(),
+		Errors:     r.agg.errors,
+		Throughput: r.agg.throughput(),
+		SLOs:       r.SLOs,
+		TimeSeries: r.agg.series,
+		Times:      r.agg.times,
+		Phases:     r.agg.phases,
 		Spawned:    []*Result{},
 		childMutex: &sync.Mutex{}}
+	if r.Rate.IsSet() {
+		result.IntendedRate = r.Rate.PerSecond()
+		result.AchievedRate = r.agg.startRate()
+		if result.AchievedRate == 0 {
+			result.AchievedRate = result.IntendedRate
+		}
+	}
+	if runs := int(atomic.LoadInt32(&r.runs)); runs > 1 {
+		result.Spawns = runs
+	}
+	if r.isTimed() && r.Stages == nil {
+		result.Duration = &Duration{Duration: r.Duration.Duration}
+	}
+	if r.Stages != nil {
+		result.Stages = r.computeStageResults()
+	}
+	if r.Assert != nil {
+		result.Assertions = r.agg.Assertions()
+		if result.Assertions.Failed > 0 {
+			log.Warning("%d of %d response(s) from %s failed assertions.", result.Assertions.Failed, r.agg.count, r.URL)
+		}
+	}
 
 	log.Notice("SUMMARY: %s %s", r, result.Times)
 
-	statusesVals := make([]Status, len(statuses))
-	i := 0
-	for _, s := range statuses {
-		statusesVals[i] = s
-		i++
-	}
-	result.Statuses = statusesVals
+	r.Result = &result
 	// If there is a parent, we set this as the result of a spawned parent.
 	if r.Parent != nil {
-		r.Parent.Result.childMutex.Lock() // TODO: Fix data race.
+		r.Parent.Result.childMutex.Lock()
 		r.Parent.Result.Spawned = append(r.Parent.Result.Spawned, &result)
 		r.Parent.Result.childMutex.Unlock()
 		runtime.Gosched()
-	} else {
-		r.Result = &result
 	}
-	// Let's now unset the children because we don't need them anymore.
-	r.Children = nil
 	wg.Done()
 }
 
+// repetitions returns the number of requests to send per run, or the number of requests sent
+// if it is not known in advance, e.g. with stages.
+func (r *Request) repetitions() int {
+	if r.Repeat == 0 {
+		return int(atomic.LoadInt64(&r.sent))
+	}
+	return r.Repeat
+}
+
+// isTimed returns whether this request is bound by time instead of a number of repetitions.
+func (r *Request) isTimed() bool {
+	return r.Stages != nil || (r.Duration.Duration > 0 && !r.Rate.IsSet())
+}
+
 // String implements the Stringer interface.
 func (r *Request) String() string {
+	if r.Stages != nil {
+		return fmt.Sprintf("requests (stages=%d) to %s", len(r.Stages), r.URL)
+	}
+	if r.isTimed() {
+		return fmt.Sprintf("requests (concurrency=%d, duration=%s) to %s", r.Concurrency, r.Duration.String(), r.URL)
+	}
+	if r.Rate.IsSet() {
+		return fmt.Sprintf("%d request(s) (rate=%s) to %s", r.Repeat, r.Rate, r.URL)
+	}
 	return fmt.Sprintf("%d request(s) (concurrency=%d) to %s", r.Repeat, r.Concurrency, r.URL)
 }
 
-// setParentRequest sets the parent request recursively for all children.
-func setParentRequest(parent *Request, children []*Request) {
-	if children != nil {
-		for _, child := range children {
-			child.Validate()
-			child.Parent = parent
-			setParentRequest(child, child.Children)
+// setParentRequest validates and sets the parent request recursively for all children, and returns
+// the problems of the children as ValidationErrors, located relative to the parent.
+func setParentRequest(parent *Request, children []*Request) error {
+	errs := ValidationErrors{}
+	for cno, child := range children {
+		path := elementPath("", "request", cno+1, "")
+		errs.add(path, child.Validate())
+		if parent.SpawnChildren == "each" && child.isTimed() {
+			errs.add(path, fmt.Errorf("%s cannot be bound by time when spawned for each response of %s", child, parent))
 		}
+		child.Parent = parent
+		errs.add(path, setParentRequest(child, child.Children))
 	}
+	return errs.orNil()
 }
 
 // Response extends a goreq.Response with a duration.
@@ -232,13 +445,34 @@ type Response struct {
 	header        http.Header
 	cookies       []*http.Cookie
 	JSON          map[string]json.RawMessage
+	started       time.Time
 	duration      time.Duration
+	timing        *phaseTimes
+	stage         int
+	body          []byte              // Body of the response, only kept until the assertions are checked.
+	asserted      bool                // Whether the assertions were checked.
+	failures      []*AssertionFailure // Failed assertions, if any.
+	uri           string              // URL which was requested.
+	err           string              // Why the request could not be sent, if it errored.
+	sent          int64               // Bytes of the request body.
+	received      int64               // Bytes of the response body.
+}
+
+// errored returns whether no response was received, the response had a 5xx status or it failed assertions.
+func (resp *Response) errored() bool {
+	return resp.statusCode == -1 || resp.statusCode >= 500 || resp.failures != nil
 }
 
 // FromGoResp initializes the Response from a goreq.Response.
 func (resp *Response) FromGoResp(gresp *goreq.Response, err error, startTime time.Time) {
+	resp.started = startTime
 	if err == nil {
-		gresp.Body.FromJsonTo(&resp.JSON)
+		// Reading the whole body in order to time its download.
+		if body, rerr := ioutil.ReadAll(gresp.Body); rerr == nil {
+			json.Unmarshal(body, &resp.JSON)
+			resp.body = body
+			resp.received = int64(len(body))
+		}
 		gresp.Body.Close() // We can now close the body.
 		resp.statusCode = gresp.StatusCode
 		resp.contentLength = gresp.ContentLength
@@ -253,18 +487,30 @@ func (resp *Response) FromGoResp(gresp *goreq.Response, err error, startTime tim
 
 // Result store the result of a group of requests (as define by its concurrency and repetition).
 type Result struct {
-	Method      string         `xml:"method,attr"`
-	URL         string         `xml:"url,attr"`
-	Concurrency int            `xml:"concurrency,attr"`
-	Repetitions int            `xml:"repetitions,attr"`
-	Times       *Percentages   `xml:"times"`
-	Statuses    []Status       `xml:"status"`
-	StatusSum   *StatusSummary `xml:"statuses"`
-	Spawned     []*Result      `xml:"spawned"`
-	childMutex  *sync.Mutex
-	HadCookies  bool `xml:"withCookies,attr"`
-	HadHeader   bool `xml:"withHeaders,attr"`
-	HadData     bool `xml:"withData,attr"`
+	Method       string            `xml:"method,attr"`
+	URL          string            `xml:"url,attr"`
+	Concurrency  int               `xml:"concurrency,attr"`
+	Repetitions  int               `xml:"repetitions,attr"`
+	IntendedRate float64           `xml:"intendedRate,attr,omitempty"` // Requests per second which were scheduled.
+	AchievedRate float64           `xml:"achievedRate,attr,omitempty"` // Requests per second which were actually started.
+	Duration     *Duration         `xml:"duration,attr,omitempty"`     // Duration of the requests, only set if bound by time.
+	Spawns       int               `xml:"spawns,attr,omitempty"`       // Number of parent responses which spawned these requests, if more than one.
+	Weight       int               `xml:"weight,attr,omitempty"`       // Weight of this request, only set if part of a mix.
+	Errors       int               `xml:"errors,attr"`                 // Number of responses which errored, had a 5xx status or failed assertions.
+	Throughput   float64           `xml:"throughput,attr,omitempty"`   // Responses per second.
+	SLOs         []*SLO            `xml:"slo"`                         // Objectives of this request, once evaluated.
+	TimeSeries   *TimeSeries       `xml:"timeseries"`                  // Statistics of the responses bucketed by completion time.
+	Times        *Percentages      `xml:"times"`
+	Phases       *Phases           `xml:"phases"`
+	Statuses     []Status          `xml:"status"`
+	StatusSum    *StatusSummary    `xml:"statuses"`
+	Assertions   *AssertionSummary `xml:"assertions,omitempty"` // Assertion results, only set if the request has assertions.
+	Stages       []*StageResult    `xml:"stage"`
+	Spawned      []*Result         `xml:"spawned"`
+	childMutex   *sync.Mutex
+	HadCookies   bool `xml:"withCookies,attr"`
+	HadHeader    bool `xml:"withHeaders,attr"`
+	HadData      bool `xml:"withData,attr"`
 }
 
 // Equals returns whether this request is equal to the one provided as an argument.
@@ -272,7 +518,7 @@ func (r Result) Equals(o *Result) bool {
 	return r.Concurrency == o.Concurrency && r.HadCookies == o.HadCookies &&
 		r.HadData == o.HadData && r.HadHeader == o.HadHeader &&
 		r.Method == o.Method && r.Repetitions == o.Repetitions &&
-		r.URL == o.URL
+		r.URL == o.URL && r.Weight == o.Weight
 }
 
 // SetTimeState recursively sets the state of all results.
@@ -282,6 +528,12 @@ func (r Result) SetTimeState(critical time.Duration, warning time.Duration) {
 			spawned.SetTimeState(critical, warning)
 		}
 	}
+	for _, stage := range r.Stages {
+		stage.Times.SetState(critical, warning)
+	}
+	if r.TimeSeries != nil {
+		r.TimeSeries.SetTimeState(critical, warning)
+	}
 	r.Times.SetState(critical, warning)
 }
 
@@ -291,6 +543,38 @@ type Status struct {
 	Count int `xml:"number,attr"`
 }
 
+// record counts the provided status code in its class, where -1 is a request which errored.
+// Codes outside of the classes are not counted, and are logged by the collection of the responses.
+func (s *StatusSummary) record(code int) {
+	if code == -1 {
+		// An error occurred when executing this request.
+		s.None++
+		return
+	}
+	switch code / 100 {
+	case 1:
+		s.S1xx++
+	case 2:
+		s.S2xx++
+	case 3:
+		s.S3xx++
+	case 4:
+		s.S4xx++
+	case 5:
+		s.S5xx++
+	}
+}
+
+// merge adds the statuses counted in the provided summary.
+func (s *StatusSummary) merge(o *StatusSummary) {
+	s.None += o.None
+	s.S1xx += o.S1xx
+	s.S2xx += o.S2xx
+	s.S3xx += o.S3xx
+	s.S4xx += o.S4xx
+	s.S5xx += o.S5xx
+}
+
 // StatusSummary stores the summary of statuses got for a group of requests.
 type StatusSummary struct {
 	None int `xml:"errored,attr"`
@@ -1,23 +1,165 @@
 package main
 
 import (
-	. "github.com/smartystreets/goconvey/convey"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
 )
 
 func TestRequests(t *testing.T) {
 	Convey("A request validation, ", t, func() {
-		Convey("should panic if there is more concurrency than repetition", func() {
+		Convey("should fail if there is more concurrency than repetition", func() {
 			r := Request{Concurrency: 2, Repeat: 1}
-			So(r.Validate, ShouldPanic)
+			So(r.Validate(), ShouldNotBeNil)
 		})
-		Convey("should panic if there is no method", func() {
+		Convey("should fail if there is no method", func() {
 			r := Request{Concurrency: 1, Repeat: 1}
-			So(r.Validate, ShouldPanic)
+			So(r.Validate(), ShouldNotBeNil)
 		})
-		Convey("should panic if the response type is not supported", func() {
+		Convey("should fail if the response type is not supported", func() {
 			r := Request{Concurrency: 1, Repeat: 1, Method: "Not checked", RespType: "unsupported"}
-			So(r.Validate, ShouldPanic)
+			So(r.Validate(), ShouldNotBeNil)
+		})
+		Convey("should fail if the children spawning mode is not supported", func() {
+			r := Request{Concurrency: 1, Repeat: 1, Method: "get", SpawnChildren: "twice", URL: &URL{}}
+			So(r.Validate(), ShouldNotBeNil)
 		})
+		Convey("should fail if a child spawned for each response is bound by time", func() {
+			child := &Request{Concurrency: 1, Method: "get", Duration: Duration{Duration: time.Second}, URL: &URL{}}
+			r := Request{Concurrency: 1, Repeat: 1, Method: "get", SpawnChildren: "each", URL: &URL{}, Children: []*Request{child}}
+			So(r.Validate(), ShouldBeNil)
+			err := setParentRequest(&r, r.Children)
+			So(err, ShouldNotBeNil)
+			So(err.(ValidationErrors)[0].Path, ShouldEqual, "request[1]")
+		})
+		Convey("with a rate", func() {
+			Convey("should compute the repetitions from the duration", func() {
+				r := Request{Method: "get", Rate: Rate{Count: 200, Per: time.Second}, Duration: Duration{Duration: time.Second * 5}, URL: &URL{}}
+				So(r.Validate(), ShouldBeNil)
+				So(r.Repeat, ShouldEqual, 1000)
+				So(r.Concurrency, ShouldEqual, 1000)
+			})
+			Convey("should fail without repeat nor duration", func() {
+				r := Request{Method: "get", Rate: Rate{Count: 200, Per: time.Second}, URL: &URL{}}
+				So(r.Validate(), ShouldNotBeNil)
+			})
+			Convey("should fail if it does not send any request", func() {
+				r := Request{Method: "get", Rate: Rate{Count: 1, Per: time.Minute}, Duration: Duration{Duration: time.Second}, URL: &URL{}}
+				So(r.Validate(), ShouldNotBeNil)
+			})
+		})
+		Convey("with a duration", func() {
+			Convey("should ignore the repetitions", func() {
+				r := Request{Concurrency: 10, Repeat: 1, Method: "get", Duration: Duration{Duration: time.Second}, URL: &URL{}}
+				So(r.Validate(), ShouldBeNil)
+				So(r.Repeat, ShouldEqual, 0)
+				So(r.isTimed(), ShouldBeTrue)
+				So(r.String(), ShouldEqual, "requests (concurrency=10, duration=1s) to ")
+			})
+			Convey("should fail without a concurrency", func() {
+				r := Request{Method: "get", Duration: Duration{Duration: time.Second}, URL: &URL{}}
+				So(r.Validate(), ShouldNotBeNil)
+			})
+			Convey("should fail if there are also stages", func() {
+				r := Request{Concurrency: 1, Method: "get", Duration: Duration{Duration: time.Second},
+					Stages: []*Stage{{Duration: Duration{Duration: time.Second}}}, URL: &URL{}}
+				So(r.Validate(), ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestClosedModelDuration(t *testing.T) {
+	Convey("Requests sent during a given duration", t, func() {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(time.Millisecond * 10)
+			w.WriteHeader(204)
+		}))
+		defer ts.Close()
+		profile = &Profile{UserAgent: "StressGauge/0.x"}
+		r := Request{Method: "get", Concurrency: 5, Duration: Duration{Duration: time.Millisecond * 500}, URL: &URL{Base: ts.URL}}
+		r.Validate()
+		var wg sync.WaitGroup
+		start := time.Now()
+		r.Spawn(nil, &wg)
+		wg.Wait()
+		So(time.Since(start), ShouldBeBetween, time.Millisecond*500, time.Millisecond*750)
+		So(r.Result.Repetitions, ShouldBeGreaterThan, 50)
+		So(r.Result.StatusSum.S2xx, ShouldEqual, r.Result.Repetitions)
+		So(r.Result.Duration.Duration, ShouldEqual, time.Millisecond*500)
+		So(r.Result.Stages, ShouldBeNil)
+	})
+}
+
+func TestSpawnChildrenForEachResponse(t *testing.T) {
+	Convey("Children spawned for each response use that response", t, func() {
+		var sessions int32
+		var mutex sync.Mutex
+		seen := map[string]int{}
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/login/":
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: strconv.Itoa(int(atomic.AddInt32(&sessions, 1)))})
+				w.WriteHeader(204)
+			case "/browse/":
+				cookie, err := r.Cookie("session")
+				if err != nil {
+					w.WriteHeader(400)
+					return
+				}
+				mutex.Lock()
+				seen[cookie.Value]++
+				mutex.Unlock()
+				w.WriteHeader(204)
+			}
+		}))
+		defer ts.Close()
+		profile = &Profile{UserAgent: "StressGauge/0.x"}
+		browse := &Request{Method: "get", Repeat: 2, Concurrency: 1, FwdCookies: true, URL: &URL{Base: ts.URL + "/browse/"}}
+		r := Request{Method: "post", Repeat: 5, Concurrency: 5, SpawnChildren: "each", URL: &URL{Base: ts.URL + "/login/"},
+			Children: []*Request{browse}}
+		r.Validate()
+		setParentRequest(&r, r.Children)
+		var wg sync.WaitGroup
+		r.Spawn(nil, &wg)
+		wg.Wait()
+		So(len(seen), ShouldEqual, 5)
+		for _, count := range seen {
+			So(count, ShouldEqual, 2)
+		}
+		So(len(r.Result.Spawned), ShouldEqual, 1)
+		So(r.Result.Spawned[0].Spawns, ShouldEqual, 5)
+		So(r.Result.Spawned[0].Repetitions, ShouldEqual, 2)
+		So(r.Result.Spawned[0].StatusSum.S2xx, ShouldEqual, 10)
+	})
+}
+
+func TestOpenModel(t *testing.T) {
+	Convey("Requests sent at a given rate", t, func() {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(time.Millisecond * 50)
+			w.WriteHeader(204)
+		}))
+		defer ts.Close()
+		profile = &Profile{UserAgent: "StressGauge/0.x"}
+		r := Request{Method: "get", Rate: Rate{Count: 100, Per: time.Second}, Duration: Duration{Duration: time.Millisecond * 500},
+			URL: &URL{Base: ts.URL}}
+		r.Validate()
+		var wg sync.WaitGroup
+		start := time.Now()
+		r.Spawn(nil, &wg)
+		wg.Wait()
+		// The slow responses must not delay the start of the following requests.
+		So(time.Since(start), ShouldBeLessThan, time.Millisecond*750)
+		So(r.Result.Repetitions, ShouldEqual, 50)
+		So(r.Result.StatusSum.S2xx, ShouldEqual, 50)
+		So(r.Result.IntendedRate, ShouldEqual, 100)
+		So(r.Result.AchievedRate, ShouldBeBetween, 80, 120)
 	})
 }
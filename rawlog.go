@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// rawLogColumns are the columns of the CSV raw log, in order.
+var rawLogColumns = []string{"timestamp", "test", "path", "method", "url", "status", "content_length", "duration_ms", "error"}
+
+// newFileSink returns a lossless sink which logs each sample to the provided file, as CSV if its extension
+// is .csv or as newline-delimited JSON if it is .ndjson, .jsonl or .json.
+func newFileSink(filename string) (Sink, error) {
+	ext := filepath.Ext(filename)
+	if ext != ".csv" && ext != ".ndjson" && ext != ".jsonl" && ext != ".json" {
+		return nil, fmt.Errorf("unsupported raw log `%s`: expected a .csv, .ndjson, .jsonl or .json file", filename)
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	buffered := bufio.NewWriter(file)
+	if ext == ".csv" {
+		s := &CSVSink{file: file, buffered: buffered, writer: csv.NewWriter(buffered)}
+		return s, s.writer.Write(rawLogColumns)
+	}
+	return &NDJSONSink{file: file, buffered: buffered, encoder: json.NewEncoder(buffered)}, nil
+}
+
+// CSVSink logs each sample as a row of a CSV file.
+type CSVSink struct {
+	file     *os.File
+	buffered *bufio.Writer
+	writer   *csv.Writer
+}
+
+// Send implements the Sink interface.
+func (s *CSVSink) Send(sample *Sample) error {
+	return s.writer.Write([]string{sample.Started.Format(time.RFC3339Nano), sample.Test, sample.Path, sample.Method, sample.URI,
+		strconv.Itoa(sample.Status), strconv.FormatInt(sample.ContentLength, 10),
+		strconv.FormatFloat(milliseconds(sample.Duration), 'f', -1, 64), sample.Error})
+}
+
+// lossless implements the LosslessSink interface.
+func (s *CSVSink) lossless() {}
+
+// Close implements the Sink interface.
+func (s *CSVSink) Close() error {
+	s.writer.Flush()
+	if err := s.writer.Error(); err != nil {
+		return err
+	}
+	return closeBuffered(s.buffered, s.file)
+}
+
+// NDJSONSink logs each sample as a JSON object per line.
+type NDJSONSink struct {
+	file     *os.File
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+}
+
+// JSONSample is the JSON record of a sample, with the same fields as the CSV columns.
+type JSONSample struct {
+	Timestamp     string  `json:"timestamp"`
+	Test          string  `json:"test"`
+	Path          string  `json:"path"`
+	Method        string  `json:"method"`
+	URL           string  `json:"url"`
+	Status        int     `json:"status"`
+	ContentLength int64   `json:"contentLength"`
+	DurationMs    float64 `json:"durationMs"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// Send implements the Sink interface.
+func (s *NDJSONSink) Send(sample *Sample) error {
+	return s.encoder.Encode(&JSONSample{Timestamp: sample.Started.Format(time.RFC3339Nano), Test: sample.Test, Path: sample.Path,
+		Method: sample.Method, URL: sample.URI, Status: sample.Status, ContentLength: sample.ContentLength,
+		DurationMs: milliseconds(sample.Duration), Error: sample.Error})
+}
+
+// lossless implements the LosslessSink interface.
+func (s *NDJSONSink) lossless() {}
+
+// Close implements the Sink interface.
+func (s *NDJSONSink) Close() error {
+	return closeBuffered(s.buffered, s.file)
+}
+
+// closeBuffered flushes the buffered writer before closing its file.
+func closeBuffered(buffered *bufio.Writer, file *os.File) error {
+	if err := buffered.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
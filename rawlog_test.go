@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRawLog(t *testing.T) {
+	Convey("Testing the raw log of every request", t, func() {
+		dir, _ := ioutil.TempDir("", "sg")
+		defer os.RemoveAll(dir)
+		started := time.Date(2017, 7, 14, 2, 40, 0, 500, time.UTC)
+		child := &Request{Method: "GET", URL: &URL{Base: "http://example.org/items"}}
+		parent := &Request{Method: "POST", URL: &URL{Base: "http://example.org/login"}, Children: []*Request{child}}
+		csvSink, err := newFileSink(filepath.Join(dir, "requests.csv"))
+		So(err, ShouldBeNil)
+		ndjsonSink, err := newFileSink(filepath.Join(dir, "requests.ndjson"))
+		So(err, ShouldBeNil)
+		s := newStreamer(csvSink, ndjsonSink)
+		s.Watch(&StressTest{Name: "Raw, log", Requests: []*Request{parent}})
+		s.observe(parent, &Response{statusCode: 200, contentLength: 12, uri: "http://example.org/login", started: started,
+			duration: time.Microsecond * 1500})
+		s.observe(child, &Response{statusCode: 200, contentLength: -1, uri: "http://example.org/items?page=2", started: started,
+			duration: time.Millisecond, failures: []*AssertionFailure{{Check: "body contains ok", Message: "body does not contain \"ok\""}}})
+		s.observe(child, &Response{statusCode: -1, contentLength: -1, uri: "http://example.org/items?page=3", started: started,
+			err: "connection refused"})
+		So(s.Close(), ShouldBeNil)
+
+		Convey("As CSV", func() {
+			file, _ := os.Open(filepath.Join(dir, "requests.csv"))
+			defer file.Close()
+			records, err := csv.NewReader(file).ReadAll()
+			So(err, ShouldBeNil)
+			So(len(records), ShouldEqual, 4)
+			So(records[0], ShouldResemble, rawLogColumns)
+			So(records[1], ShouldResemble, []string{"2017-07-14T02:40:00.0000005Z", "Raw, log", "POST http://example.org/login", "POST",
+				"http://example.org/login", "200", "12", "1.5", ""})
+			So(records[2][2], ShouldEqual, "POST http://example.org/login > GET http://example.org/items")
+			So(records[2][4], ShouldEqual, "http://example.org/items?page=2")
+			So(records[2][8], ShouldEqual, `body contains ok: body does not contain "ok"`)
+			So(records[3][5], ShouldEqual, "-1")
+			So(records[3][8], ShouldEqual, "connection refused")
+		})
+
+		Convey("As newline-delimited JSON", func() {
+			content, _ := ioutil.ReadFile(filepath.Join(dir, "requests.ndjson"))
+			lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+			So(len(lines), ShouldEqual, 3)
+			first := JSONSample{}
+			So(json.Unmarshal([]byte(lines[0]), &first), ShouldBeNil)
+			So(first, ShouldResemble, JSONSample{Timestamp: "2017-07-14T02:40:00.0000005Z", Test: "Raw, log",
+				Path: "POST http://example.org/login", Method: "POST", URL: "http://example.org/login", Status: 200,
+				ContentLength: 12, DurationMs: 1.5})
+			So(lines[0], ShouldNotContainSubstring, `"error"`)
+			So(lines[2], ShouldContainSubstring, `"error":"connection refused"`)
+		})
+
+		Convey("Only CSV and NDJSON files are supported", func() {
+			_, err := newFileSink(filepath.Join(dir, "requests.xml"))
+			So(err, ShouldNotBeNil)
+			_, err = newFileSink(filepath.Join(dir, "missing", "requests.csv"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chartColors are the colors of the series of the latency chart, and of the status classes of the status chart.
+var chartColors = map[string]string{
+	"p50": "#5cb85c", "p95": "#f0ad4e", "p99": "#d9534f",
+	"errored": "#777777", "1xx": "#5bc0de", "2xx": "#5cb85c", "3xx": "#337ab7", "4xx": "#f0ad4e", "5xx": "#d9534f",
+	"nominal": "#5cb85c", "warning": "#f0ad4e", "critical": "#d9534f",
+}
+
+// reportResult is a result along with what is needed to render it in the HTML report.
+type reportResult struct {
+	*Result
+	Name    string
+	Spawned []*reportResult
+}
+
+// newReportResults returns the results to render, including the spawned ones.
+func newReportResults(results []*Result) []*reportResult {
+	rendered := []*reportResult{}
+	for _, result := range results {
+		rendered = append(rendered, &reportResult{Result: result, Name: fmt.Sprintf("%s %s", result.Method, result.URL),
+			Spawned: newReportResults(result.Spawned)})
+	}
+	return rendered
+}
+
+// reportStat is a labeled response time of the statistics table.
+type reportStat struct {
+	Label string
+	Value *Duration
+}
+
+// Stats returns the statistics of the response times, in the order of the statistics table.
+func (r *reportResult) Stats() []reportStat {
+	stats := []reportStat{{"mean", &Duration{Duration: r.Times.Mean(), State: r.Times.MeanValue.State}},
+		{"stddev", &Duration{Duration: r.Times.StdDev()}}, {"shortest", r.Times.Percentage(0)}}
+	for _, perc := range reportedPercentiles {
+		stats = append(stats, reportStat{"p" + strconv.FormatFloat(perc, 'f', -1, 64), r.Times.Quantile(perc)})
+	}
+	return append(stats, reportStat{"longest", r.Times.Percentage(100)})
+}
+
+// Phases returns the phases which happened, in chronological order.
+func (r *reportResult) Phases() []reportStat {
+	phases := []reportStat{}
+	if r.Result.Phases == nil {
+		return phases
+	}
+	for _, phase := range []struct {
+		label string
+		times *Percentages
+	}{{"DNS lookup", r.Result.Phases.DNS}, {"TCP connect", r.Result.Phases.Connect}, {"TLS handshake", r.Result.Phases.TLS},
+		{"Time to first byte", r.Result.Phases.TTFB}, {"Body download", r.Result.Phases.Transfer}} {
+		if phase.times.Len() > 0 {
+			phases = append(phases, reportStat{phase.label, &Duration{Duration: phase.times.Mean()}})
+		}
+	}
+	return phases
+}
+
+// LatencyChart returns an SVG line chart of the p50, p95 and p99 response times over time.
+func (r *reportResult) LatencyChart() template.HTML {
+	if r.TimeSeries == nil || len(r.TimeSeries.Buckets) < 2 {
+		return ""
+	}
+	buckets := r.TimeSeries.Buckets
+	const width, height, pad = 480.0, 200.0, 45.0
+	series := []string{"p50", "p95", "p99"}
+	values := map[string][]float64{}
+	var highest float64
+	for _, name := range series {
+		perc, _ := strconv.ParseFloat(name[1:], 64)
+		for _, bucket := range buckets {
+			ms := milliseconds(bucket.Times.Quantile(perc).Duration)
+			values[name] = append(values[name], ms)
+			highest = math.Max(highest, ms)
+		}
+	}
+	if highest == 0 {
+		highest = 1
+	}
+	x := func(i int) float64 { return pad + float64(i)*(width-2*pad)/float64(len(buckets)-1) }
+	y := func(ms float64) float64 { return height - pad - ms*(height-2*pad)/highest }
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, `<svg class="chart" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f">`, width, height, width, height)
+	fmt.Fprintf(&svg, `<text x="%.0f" y="15" class="title">Response times over time</text>`, pad)
+	fmt.Fprintf(&svg, `<line x1="%.0f" y1="%.0f" x2="%.0f" y2="%.0f" class="axis"/>`, pad, height-pad, width-pad, height-pad)
+	fmt.Fprintf(&svg, `<line x1="%.0f" y1="%.0f" x2="%.0f" y2="%.0f" class="axis"/>`, pad, pad, pad, height-pad)
+	fmt.Fprintf(&svg, `<text x="%.0f" y="%.0f" class="label" text-anchor="end">%s</text>`, pad-4, pad+4, formatMs(highest))
+	fmt.Fprintf(&svg, `<text x="%.0f" y="%.0f" class="label" text-anchor="end">0</text>`, pad-4, height-pad+4)
+	fmt.Fprintf(&svg, `<text x="%.0f" y="%.0f" class="label">0s</text>`, pad, height-pad+15)
+	fmt.Fprintf(&svg, `<text x="%.0f" y="%.0f" class="label" text-anchor="end">%s</text>`, width-pad, height-pad+15,
+		r.TimeSeries.Interval.Duration*time.Duration(len(buckets)))
+	for sno, name := range series {
+		points := []string{}
+		for i, ms := range values[name] {
+			points = append(points, fmt.Sprintf("%.1f,%.1f", x(i), y(ms)))
+		}
+		fmt.Fprintf(&svg, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5"/>`, strings.Join(points, " "), chartColors[name])
+		fmt.Fprintf(&svg, `<text x="%.0f" y="%.0f" class="label" fill="%s">%s</text>`, width-pad+5, pad+float64(sno)*14, chartColors[name], name)
+	}
+	svg.WriteString(`</svg>`)
+	return template.HTML(svg.String())
+}
+
+// PercentileChart returns an SVG bar chart of the reported percentiles, colored by their state.
+func (r *reportResult) PercentileChart() template.HTML {
+	stats := r.Stats()[3:] // Skipping the mean, standard deviation and shortest.
+	const width, height, pad = 480.0, 200.0, 45.0
+	var highest float64
+	for _, stat := range stats {
+		highest = math.Max(highest, milliseconds(stat.Value.Duration))
+	}
+	if highest == 0 {
+		highest = 1
+	}
+	barWidth := (width - 2*pad) / float64(len(stats))
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, `<svg class="chart" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f">`, width, height, width, height)
+	fmt.Fprintf(&svg, `<text x="%.0f" y="15" class="title">Response time percentiles</text>`, pad)
+	fmt.Fprintf(&svg, `<line x1="%.0f" y1="%.0f" x2="%.0f" y2="%.0f" class="axis"/>`, pad, height-pad, width-pad, height-pad)
+	fmt.Fprintf(&svg, `<text x="%.0f" y="%.0f" class="label" text-anchor="end">%s</text>`, pad-4, pad+4, formatMs(highest))
+	for sno, stat := range stats {
+		ms := milliseconds(stat.Value.Duration)
+		barHeight := ms * (height - 2*pad) / highest
+		color := chartColors[stat.Value.State]
+		if color == "" {
+			color = chartColors["p50"]
+		}
+		left := pad + float64(sno)*barWidth
+		fmt.Fprintf(&svg, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"><title>%s: %s</title></rect>`,
+			left+2, height-pad-barHeight, barWidth-4, barHeight, color, stat.Label, stat.Value)
+		fmt.Fprintf(&svg, `<text x="%.1f" y="%.0f" class="label" text-anchor="middle">%s</text>`, left+barWidth/2, height-pad+15, stat.Label)
+	}
+	svg.WriteString(`</svg>`)
+	return template.HTML(svg.String())
+}
+
+// StatusChart returns an SVG pie chart of the status classes.
+func (r *reportResult) StatusChart() template.HTML {
+	if r.StatusSum == nil {
+		return ""
+	}
+	slices := []struct {
+		label string
+		count int
+	}{{"errored", r.StatusSum.None}, {"1xx", r.StatusSum.S1xx}, {"2xx", r.StatusSum.S2xx}, {"3xx", r.StatusSum.S3xx},
+		{"4xx", r.StatusSum.S4xx}, {"5xx", r.StatusSum.S5xx}}
+	var total int
+	for _, slice := range slices {
+		total += slice.count
+	}
+	if total == 0 {
+		return ""
+	}
+	const width, height, radius = 240.0, 200.0, 70.0
+	cx, cy := radius+20, height/2+10
+	var svg bytes.Buffer
+	fmt.Fprintf(&svg, `<svg class="chart" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f">`, width, height, width, height)
+	svg.WriteString(`<text x="20" y="15" class="title">Statuses</text>`)
+	angle := -math.Pi / 2
+	legend := 0
+	for _, slice := range slices {
+		if slice.count == 0 {
+			continue
+		}
+		share := float64(slice.count) / float64(total)
+		title := fmt.Sprintf("<title>%s: %d (%.1f%%)</title>", slice.label, slice.count, share*100)
+		if slice.count == total {
+			fmt.Fprintf(&svg, `<circle cx="%.1f" cy="%.1f" r="%.0f" fill="%s">%s</circle>`, cx, cy, radius, chartColors[slice.label], title)
+		} else {
+			end := angle + share*2*math.Pi
+			large := 0
+			if share > 0.5 {
+				large = 1
+			}
+			fmt.Fprintf(&svg, `<path d="M%.1f,%.1f L%.1f,%.1f A%.0f,%.0f 0 %d,1 %.1f,%.1f Z" fill="%s">%s</path>`,
+				cx, cy, cx+radius*math.Cos(angle), cy+radius*math.Sin(angle), radius, radius, large,
+				cx+radius*math.Cos(end), cy+radius*math.Sin(end), chartColors[slice.label], title)
+			angle = end
+		}
+		fmt.Fprintf(&svg, `<rect x="%.0f" y="%d" width="10" height="10" fill="%s"/>`, 2*radius+35, 40+legend*16, chartColors[slice.label])
+		fmt.Fprintf(&svg, `<text x="%.0f" y="%d" class="label">%s: %d</text>`, 2*radius+50, 49+legend*16, slice.label, slice.count)
+		legend++
+	}
+	svg.WriteString(`</svg>`)
+	return template.HTML(svg.String())
+}
+
+// formatMs formats a number of milliseconds as a duration.
+func formatMs(ms float64) string {
+	return time.Duration(ms * float64(time.Millisecond)).Round(time.Microsecond).String()
+}
+
+// htmlReport is the template of the self-contained HTML report.
+var htmlReport = template.Must(template.New("report").Funcs(template.FuncMap{"inc": func(i int) int { return i + 1 }}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Name}} - sg report</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; color: #333; margin: 0 auto; max-width: 1200px; padding: 0 20px; }
+h1 { border-bottom: 1px solid #ddd; padding-bottom: 8px; }
+h2 { margin-top: 40px; }
+table { border-collapse: collapse; margin: 10px 0; }
+th, td { border: 1px solid #ddd; padding: 4px 10px; text-align: center; }
+th { background: #f5f5f5; }
+details { border-left: 3px solid #337ab7; margin: 15px 0; padding-left: 15px; }
+details details { border-left-color: #5bc0de; }
+summary { cursor: pointer; font-weight: bold; font-size: 1.1em; }
+.muted { color: #777; }
+.nominal, .passed { background: #dff0d8; }
+.warning { background: #fcf8e3; }
+.critical, .failed { background: #f2dede; }
+.charts { display: flex; flex-wrap: wrap; gap: 10px; }
+.chart { border: 1px solid #eee; }
+.chart .title { font-size: 13px; font-weight: bold; }
+.chart .label { font-size: 10px; fill: #555; }
+.chart .axis { stroke: #999; }
+</style>
+</head>
+<body>
+<h1>{{.Name}}</h1>
+<ul>{{range .Tests}}<li><a href="#{{.Name}}">{{.Name}}</a></li>{{end}}</ul>
+{{range .Tests}}
+<h2 id="{{.Name}}">{{.Name}}</h2>
+<p class="muted">{{.Description}}</p>
+<p class="muted">Critical threshold set to <span class="critical">{{.CriticalTh.String}}</span>,
+warning threshold set to <span class="warning">{{.WarningTh.String}}</span>.</p>
+{{template "slos" .SLOs}}
+{{if .Scenario}}{{if .Scenario.Result}}<p>{{.Scenario.Users}} virtual user(s) completed {{.Scenario.Result.Iterations}} iteration(s) of the scenario.</p>{{end}}{{end}}
+{{range .Results}}{{template "result" .}}{{end}}
+{{end}}
+<p class="muted">Generated by sg.</p>
+</body>
+</html>
+{{define "slos"}}{{if .}}
+<table>
+<tr><th>Objective</th><th>Actual</th><th>Status</th></tr>
+{{range .}}<tr class="{{.Status}}"><td>{{.Rule}}</td><td>{{.Actual}}</td><td>{{.Status}}</td></tr>{{end}}
+</table>
+{{end}}{{end}}
+{{define "result"}}
+<details open>
+<summary>{{.Name}}</summary>
+<p>{{.Times.Len}} request(s) with a concurrency of {{.Concurrency}}{{if .Duration}} over {{.Duration.String}}{{end}}{{if .IntendedRate}}, at {{printf "%.2f" .IntendedRate}} req/s (achieved {{printf "%.2f" .AchievedRate}} req/s){{end}}{{if .Spawns}}, for each of the {{.Spawns}} parent responses{{end}}{{if .Weight}}, with a weight of {{.Weight}}{{end}}.
+{{if .Throughput}}Throughput of {{printf "%.2f" .Throughput}} responses per second, {{end}}{{.Errors}} error(s).</p>
+{{template "slos" .SLOs}}
+<table>
+<tr>{{range .Stats}}<th>{{.Label}}</th>{{end}}</tr>
+<tr>{{range .Stats}}<td class="{{.Value.State}}">{{.Value.String}}</td>{{end}}</tr>
+</table>
+<div class="charts">{{.LatencyChart}}{{.PercentileChart}}{{.StatusChart}}</div>
+{{with .Phases}}<table>
+<tr>{{range .}}<th>{{.Label}}</th>{{end}}</tr>
+<tr>{{range .}}<td>{{.Value.String}}</td>{{end}}</tr>
+</table>{{end}}
+{{if .Statuses}}<table>
+<tr><th>Status code</th>{{range .Statuses}}<td>{{.Code}}</td>{{end}}</tr>
+<tr><th>Responses</th>{{range .Statuses}}<td>{{.Count}}</td>{{end}}</tr>
+</table>{{end}}
+{{with .Assertions}}<p class="{{if .Failed}}failed{{else}}passed{{end}}">{{.Passed}} response(s) passed and {{.Failed}} response(s) failed the assertions.</p>
+{{if .Failures}}<table>
+<tr><th>Check</th><th>Failures</th><th>Sample</th></tr>
+{{range .Failures}}<tr><td>{{.Check}}</td><td>{{.Count}}</td><td>{{.Sample}}</td></tr>{{end}}
+</table>{{end}}{{end}}
+{{if .Stages}}<table>
+<tr><th>Stage</th><th>Mode</th><th>Target</th><th>Duration</th><th>Requests</th><th>p50</th><th>p95</th><th>p99</th></tr>
+{{range $sno, $stage := .Stages}}<tr><td>{{inc $sno}}</td><td>{{.Mode}}</td><td>{{.Target}}</td><td>{{.Duration.String}}</td><td>{{.Requests}}</td>
+<td>{{(.Times.Percentage 50).String}}</td><td>{{(.Times.Percentage 95).String}}</td><td>{{(.Times.Percentage 99).String}}</td></tr>{{end}}
+</table>{{end}}
+{{range .Spawned}}{{template "result" .}}{{end}}
+</details>
+{{end}}`))
+
+// reportTest is a test along with its results to render.
+type reportTest struct {
+	*StressTest
+	Results []*reportResult
+}
+
+// saveHTMLResult writes the self-contained HTML report of the profile to the provided file.
+func saveHTMLResult(profile *Profile, filename string) error {
+	data := struct {
+		Name  string
+		Tests []*reportTest
+	}{Name: profile.Name}
+	for _, test := range profile.Tests {
+		data.Tests = append(data.Tests, &reportTest{StressTest: test, Results: newReportResults(test.Result)})
+	}
+	var content bytes.Buffer
+	if err := htmlReport.Execute(&content, data); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, content.Bytes(), 0644)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestHTMLReport(t *testing.T) {
+	Convey("Testing the self-contained HTML report", t, func() {
+		start := time.Now()
+		agg := newSeriesAggregator()
+		for i := 0; i < 30; i++ {
+			status := 200
+			if i%10 == 0 {
+				status = 503
+			}
+			agg.add(&Response{statusCode: status, started: start.Add(time.Millisecond * 100 * time.Duration(i)),
+				duration: time.Millisecond * time.Duration(10+i)})
+		}
+		So(len(agg.series.Buckets), ShouldEqual, 3)
+		So(agg.series.Buckets[0].Requests, ShouldEqual, 10)
+		child := &Result{Method: "GET", URL: "http://example.org/<child>", Concurrency: 1, Times: NewPercentages([]time.Duration{time.Second}),
+			StatusSum: &StatusSummary{S2xx: 1}, Statuses: []Status{{Code: 200, Count: 1}}}
+		top := &Result{Method: "POST", URL: "http://example.org/", Concurrency: 2, Times: agg.times, Phases: agg.phases,
+			StatusSum: agg.Summary(), Statuses: agg.Statuses(), Errors: agg.errors, TimeSeries: agg.series,
+			Stages:  []*StageResult{{Mode: "ramp", Target: 2, Duration: Duration{Duration: time.Second}, Times: agg.times}},
+			SLOs:    []*SLO{{Rule: "p50 < 1s", Actual: "25ms", Status: "passed"}},
+			Spawned: []*Result{child}}
+		top.SetTimeState(time.Second, time.Millisecond*30)
+		p := &Profile{Name: "HTML report", Tests: []*StressTest{{Name: "First test", Description: "Some description.",
+			CriticalTh: Duration{Duration: time.Second}, WarningTh: Duration{Duration: time.Millisecond * 30}, Result: []*Result{top}}}}
+
+		dir, _ := ioutil.TempDir("", "sg")
+		defer os.RemoveAll(dir)
+		filename := filepath.Join(dir, "report.html")
+		So(saveHTMLResult(p, filename), ShouldBeNil)
+		b, err := ioutil.ReadFile(filename)
+		So(err, ShouldBeNil)
+		content := string(b)
+		// The report must not depend on the network.
+		So(content, ShouldNotContainSubstring, "<link")
+		So(content, ShouldNotContainSubstring, "<script src")
+		So(content, ShouldNotContainSubstring, "cdnjs")
+		So(content, ShouldContainSubstring, "<style>")
+		So(content, ShouldContainSubstring, "<h1>HTML report</h1>")
+		So(content, ShouldContainSubstring, "Some description.")
+		// Charts.
+		So(content, ShouldContainSubstring, "Response times over time")
+		So(strings.Count(content, "<polyline"), ShouldEqual, 3)
+		So(content, ShouldContainSubstring, "Response time percentiles")
+		So(content, ShouldContainSubstring, "<title>5xx: 3 (10.0%)</title>")
+		So(content, ShouldContainSubstring, `<circle cx="90.0" cy="110.0" r="70" fill="#5cb85c"><title>2xx: 1 (100.0%)</title></circle>`)
+		// Nested results, properly escaped.
+		So(strings.Count(content, "<details open>"), ShouldEqual, 2)
+		So(content, ShouldContainSubstring, "<summary>GET http://example.org/&lt;child&gt;</summary>")
+		So(strings.Index(content, "<summary>POST"), ShouldBeLessThan, strings.Index(content, "<summary>GET"))
+		So(content, ShouldContainSubstring, `<tr class="passed"><td>p50 &lt; 1s</td><td>25ms</td><td>passed</td></tr>`)
+		So(content, ShouldContainSubstring, `<td>1</td><td>ramp</td><td>2</td><td>1s</td>`)
+		So(content, ShouldContainSubstring, `<td class="critical">1.000`)
+	})
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// Scenario stores the virtual user model of a test: each user walks the request tree
+// sequentially, one step after the other, with its own cookie jar.
+type Scenario struct {
+	Users      int             `xml:"users,attr" json:"users" yaml:"users"`                                              // Number of virtual users.
+	Iterations int             `xml:"iterations,attr,omitempty" json:"iterations,omitempty" yaml:"iterations,omitempty"` // Number of times each user walks the tree.
+	Duration   Duration        `xml:"duration,attr" json:"duration,omitzero" yaml:"duration,omitempty"`                  // Duration after which users stop starting new iterations.
+	Think      *Think          `xml:"think" json:"think,omitempty" yaml:"think,omitempty"`                               // Think time between two steps.
+	Result     *ScenarioResult `xml:"result" json:"-" yaml:"-"`                                                          // Scenario result, populated only after the test runs.
+}
+
+// Validate confirms that a scenario is correctly defined, and returns all its problems as ValidationErrors otherwise.
+func (s *Scenario) Validate() error {
+	errs := ValidationErrors{}
+	if s.Users <= 0 {
+		errs.add("", errors.New("scenario must have at least one user"))
+	}
+	if s.Iterations < 0 {
+		errs.add("", fmt.Errorf("scenario iterations of %d is negative", s.Iterations))
+	}
+	if s.Iterations == 0 && s.Duration.Duration <= 0 {
+		errs.add("", errors.New("scenario requires either a number of iterations or a duration"))
+	}
+	if s.Think != nil {
+		errs.add("think", s.Think.Validate())
+	}
+	return errs.orNil()
+}
+
+// validateScenarioRequests recursively checks that requests can be walked as steps by virtual users,
+// and returns the problems as ValidationErrors.
+func validateScenarioRequests(requests []*Request) error {
+	errs := ValidationErrors{}
+	for rno, r := range requests {
+		path := elementPath("", "request", rno+1, "")
+		if r.isTimed() || r.Rate.IsSet() {
+			errs.add(path, fmt.Errorf("%s cannot be bound by time or rate in a scenario", r))
+		}
+		if r.SpawnChildren == "each" {
+			errs.add(path, fmt.Errorf("%s cannot spawn children for each response in a scenario", r))
+		}
+		if r.Repeat == 0 {
+			r.Repeat = 1
+		}
+		errs.add(path, validateScenarioRequests(r.Children))
+	}
+	return errs.orNil()
+}
+
+func (s Scenario) String() string {
+	return fmt.Sprintf("%d user(s) (iterations=%d, duration=%s, think=%s)", s.Users, s.Iterations, s.Duration.String(), s.Think)
+}
+
+// Run starts all the virtual users and computes the results once they are done.
+func (s *Scenario) Run(requests []*Request, wg *sync.WaitGroup) {
+	wg.Add(1) // Holds the wait group until the results are computed.
+	go func() {
+		var usersWg sync.WaitGroup
+		var itMutex sync.Mutex
+		times := NewPercentages(nil) // Durations of the iterations, in constant memory however long the run.
+		var deadline time.Time
+		if s.Duration.Duration > 0 {
+			deadline = time.Now().Add(s.Duration.Duration)
+		}
+		for uno := 1; uno <= s.Users; uno++ {
+			usersWg.Add(1)
+			go func(no int) {
+				defer usersWg.Done()
+				jar, _ := cookiejar.New(nil)
+				for it := 0; s.Iterations == 0 || it < s.Iterations; it++ {
+					if !deadline.IsZero() && time.Now().After(deadline) {
+						break
+					}
+					start := time.Now()
+					s.walk(requests, nil, jar, wg)
+					itMutex.Lock()
+					times.Record(time.Since(start))
+					itMutex.Unlock()
+				}
+				log.Debug("User #%d is done.", no)
+			}(uno)
+		}
+		usersWg.Wait()
+
+		for _, r := range requests {
+			r.finishScenario(wg)
+		}
+		s.Result = &ScenarioResult{Iterations: times.Len(), Times: times}
+		log.Notice("SCENARIO SUMMARY: %d iteration(s) %s", s.Result.Iterations, s.Result.Times)
+		wg.Done()
+	}()
+}
+
+// walk sends the requests one after the other, using the response of each request as the
+// parent of its children, and pauses for the think time after each step.
+func (s *Scenario) walk(requests []*Request, parent *Response, jar http.CookieJar, wg *sync.WaitGroup) {
+	for _, r := range requests {
+		var resp *Response
+		for rno := 1; rno <= r.Repeat; rno++ {
+			resp = r.step(rno, parent, jar, wg)
+			s.Think.Pause()
+		}
+		s.walk(r.Children, resp, jar, wg)
+	}
+}
+
+// step sends this request once with the cookies of the jar, and adds its response to the list of completed requests.
+func (r *Request) step(no int, parent *Response, jar http.CookieJar, wg *sync.WaitGroup) *Response {
+	r.collectOnce.Do(func() { go r.collect(wg) })
+	greq := r.prepare(parent)
+	// The URL is generated here in order to get the cookies of the jar for it.
+	uri := r.URL.Generate()
+	stepURL, err := url.Parse(uri)
+	if err == nil {
+		for _, cookie := range jar.Cookies(stepURL) {
+			greq.AddCookie(cookie)
+		}
+	}
+	resp := r.do(no, greq, time.Time{}, uri)
+	if err == nil && resp.cookies != nil {
+		jar.SetCookies(stepURL, resp.cookies)
+	}
+	wg.Add(1)
+	r.doneWg.Add(1)
+	r.doneChan <- resp
+	return resp
+}
+
+// finishScenario waits for all the responses to be collected, and computes the results
+// of this request and then of its children.
+func (r *Request) finishScenario(wg *sync.WaitGroup) {
+	r.doneWg.Wait()
+	r.ComputeResult(wg)
+	for _, child := range r.Children {
+		child.finishScenario(wg)
+	}
+	r.Children = nil
+}
+
+// Think stores the think time between two steps of a scenario. The pause is fixed
+// if only the minimum is set, or random between the minimum and the maximum.
+type Think struct {
+	Min          Duration `xml:"min,attr" json:"min,omitzero" yaml:"min,omitempty"`
+	Max          Duration `xml:"max,attr" json:"max,omitzero" yaml:"max,omitempty"`
+	Distribution string   `xml:"distribution,attr,omitempty" json:"distribution,omitempty" yaml:"distribution,omitempty"` // Either uniform (default) or normal.
+}
+
+// Validate confirms that a think time is correctly defined, and returns the first problem otherwise.
+func (t *Think) Validate() error {
+	if t.Min.Duration < 0 {
+		return errors.New("think time minimum is negative")
+	}
+	if t.Max.Duration == 0 {
+		t.Max = t.Min
+	}
+	if t.Max.Duration < t.Min.Duration {
+		return errors.New("think time minimum is greater than maximum")
+	}
+	if t.Distribution == "" {
+		t.Distribution = "uniform"
+	}
+	if t.Distribution != "uniform" && t.Distribution != "normal" {
+		return fmt.Errorf("unknown think time distribution `%s`", t.Distribution)
+	}
+	return nil
+}
+
+// Duration returns a new think time according to the definition.
+// The normal distribution is centered between the minimum and the maximum, which are three
+// standard deviations away, and it is clamped to these values.
+func (t *Think) Duration() time.Duration {
+	spread := t.Max.Duration - t.Min.Duration
+	if spread == 0 {
+		return t.Min.Duration
+	}
+	if t.Distribution == "normal" {
+		mean := float64(t.Min.Duration) + float64(spread)/2
+		think := time.Duration(mean + rand.NormFloat64()*float64(spread)/6)
+		if think < t.Min.Duration {
+			return t.Min.Duration
+		}
+		if think > t.Max.Duration {
+			return t.Max.Duration
+		}
+		return think
+	}
+	return t.Min.Duration + time.Duration(rand.Int63n(int64(spread)))
+}
+
+// Pause sleeps for a think time, if defined.
+func (t *Think) Pause() {
+	if t != nil {
+		time.Sleep(t.Duration())
+	}
+}
+
+func (t *Think) String() string {
+	if t == nil {
+		return "none"
+	}
+	if t.Min.Duration == t.Max.Duration {
+		return t.Min.String()
+	}
+	return fmt.Sprintf("%s between %s and %s", t.Distribution, t.Min.String(), t.Max.String())
+}
+
+// ScenarioResult stores the durations of the iterations of a scenario.
+type ScenarioResult struct {
+	Iterations int          `xml:"iterations,attr"`
+	Times      *Percentages `xml:"times"`
+}
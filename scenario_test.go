@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestThink(t *testing.T) {
+	Convey("Testing think times", t, func() {
+		Convey("A think time with only a minimum is fixed", func() {
+			think := Think{Min: Duration{Duration: time.Second}}
+			So(think.Validate(), ShouldBeNil)
+			So(think.Duration(), ShouldEqual, time.Second)
+			So(think.String(), ShouldEqual, "1s")
+		})
+		Convey("Random think times are within bounds", func() {
+			for _, distribution := range []string{"uniform", "normal"} {
+				think := Think{Min: Duration{Duration: time.Second}, Max: Duration{Duration: time.Second * 3}, Distribution: distribution}
+				So(think.Validate(), ShouldBeNil)
+				for i := 0; i < 1000; i++ {
+					So(think.Duration(), ShouldBeBetweenOrEqual, time.Second, time.Second*3)
+				}
+			}
+		})
+		Convey("Invalid think times should fail validation", func() {
+			for _, think := range []Think{
+				{Min: Duration{Duration: -time.Second}},
+				{Min: Duration{Duration: time.Second * 2}, Max: Duration{Duration: time.Second}},
+				{Min: Duration{Duration: time.Second}, Distribution: "poisson"},
+			} {
+				So(think.Validate(), ShouldNotBeNil)
+			}
+		})
+		Convey("A nil think time does not pause", func() {
+			var think *Think
+			So(think.Pause, ShouldNotPanic)
+			So(think.String(), ShouldEqual, "none")
+		})
+	})
+}
+
+func TestScenario(t *testing.T) {
+	Convey("Testing scenarios", t, func() {
+		Convey("Invalid scenarios should fail validation", func() {
+			So((&Scenario{Iterations: 1}).Validate(), ShouldNotBeNil)
+			So((&Scenario{Users: 1}).Validate(), ShouldNotBeNil)
+			So((&Scenario{Users: 1, Iterations: -1}).Validate(), ShouldNotBeNil)
+			So((&Scenario{Users: 1, Iterations: 1, Think: &Think{Min: Duration{Duration: -time.Second}}}).Validate(), ShouldNotBeNil)
+			So((&Scenario{Users: 1, Iterations: 1}).Validate(), ShouldBeNil)
+		})
+		Convey("Requests which cannot be walked should fail validation", func() {
+			req := func() []*Request { return []*Request{{Method: "GET", URL: &URL{}}} }
+			timed := req()
+			timed[0].Duration = Duration{Duration: time.Second}
+			So(validateScenarioRequests(timed), ShouldNotBeNil)
+			each := req()
+			each[0].Children = req()
+			each[0].Children[0].SpawnChildren = "each"
+			err := validateScenarioRequests(each)
+			So(err, ShouldNotBeNil)
+			So(err.(ValidationErrors)[0].Path, ShouldEqual, "request[1] > request[1]")
+			valid := req()
+			So(validateScenarioRequests(valid), ShouldBeNil)
+			So(valid[0].Repeat, ShouldEqual, 1)
+		})
+		Convey("Virtual users walk the tree with their own cookies", func() {
+			var sessions int32
+			var mutex sync.Mutex
+			steps := map[string]int{}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/login/" {
+					http.SetCookie(w, &http.Cookie{Name: "session", Value: strconv.Itoa(int(atomic.AddInt32(&sessions, 1))), Path: "/"})
+					w.WriteHeader(204)
+					return
+				}
+				cookie, err := r.Cookie("session")
+				if err != nil {
+					w.WriteHeader(401)
+					return
+				}
+				mutex.Lock()
+				steps[cookie.Value+r.URL.Path]++
+				mutex.Unlock()
+				w.WriteHeader(204)
+			}))
+			defer ts.Close()
+			profileData := `<sg name="Scenario" uid="1" user-agent="StressGauge/0.x">
+				<test name="Journey" critical="1s" warning="750ms">
+					<scenario users="3" iterations="2"><think min="10ms" /></scenario>
+					<request method="post"><url base="` + ts.URL + `/login/" />
+						<request method="get" repeat="2"><url base="` + ts.URL + `/browse/" />
+							<request method="post"><url base="` + ts.URL + `/cart/" /></request>
+						</request>
+					</request>
+				</test>
+			</sg>`
+			p := Profile{}
+			So(xml.Unmarshal([]byte(profileData), &p), ShouldBeNil)
+			So(p.Validate(), ShouldBeNil)
+			profile = &p
+			var wg sync.WaitGroup
+			p.Tests[0].Scenario.Run(p.Tests[0].Requests, &wg)
+			wg.Wait()
+			// Each of the six iterations logged in once, and then used its own session only.
+			So(sessions, ShouldEqual, 6)
+			So(len(steps), ShouldEqual, 12)
+			for step, count := range steps {
+				if strings.HasSuffix(step, "/browse/") {
+					So(count, ShouldEqual, 2)
+				} else {
+					So(count, ShouldEqual, 1)
+				}
+			}
+			login := p.Tests[0].Requests[0].Result
+			So(login.StatusSum.S2xx, ShouldEqual, 6)
+			So(len(login.Spawned), ShouldEqual, 1)
+			So(login.Spawned[0].StatusSum.S2xx, ShouldEqual, 12)
+			So(len(login.Spawned[0].Spawned), ShouldEqual, 1)
+			So(login.Spawned[0].Spawned[0].StatusSum.S2xx, ShouldEqual, 6)
+			result := p.Tests[0].Scenario.Result
+			So(result.Iterations, ShouldEqual, 6)
+			// Each iteration has four steps, each followed by the think time.
+			So(result.Times.Percentage(0).Duration, ShouldBeGreaterThanOrEqualTo, time.Millisecond*40)
+		})
+	})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"time"
+)
+
+// bucketInterval is the width of each bucket of the time series, set by the interval attribute of the profile.
+var bucketInterval = time.Second
+
+// bucketFigures is the precision of the histogram of each bucket, lower than that of the whole run
+// to limit the memory used by long runs.
+const bucketFigures = 2
+
+// maxBuckets is the number of buckets beyond which the interval of a time series is doubled and its
+// buckets merged two by two, so that the memory used does not grow with the duration of the run.
+const maxBuckets = 240
+
+// TimeSeries stores the statistics of the responses of a request bucketed by completion time.
+type TimeSeries struct {
+	Interval Duration  `xml:"interval,attr"`
+	Buckets  []*Bucket `xml:"bucket"`
+	origin   time.Time // Start time of the first response, from which the buckets are offset.
+}
+
+// Bucket stores the statistics of the responses which completed during an interval of the run.
+type Bucket struct {
+	Offset    Duration       `xml:"offset,attr"` // Offset of the start of the bucket from the start of the run.
+	Requests  int            `xml:"requests,attr"`
+	Errors    int            `xml:"errors,attr"` // Responses which errored, had a 5xx status or failed assertions.
+	StatusSum *StatusSummary `xml:"statuses"`
+	Times     *Percentages   `xml:"times"`
+}
+
+// newTimeSeries returns an empty time series using the configured bucket interval.
+func newTimeSeries() *TimeSeries {
+	return &TimeSeries{Interval: Duration{Duration: bucketInterval}}
+}
+
+// add records the provided response in the bucket of its completion time.
+func (s *TimeSeries) add(resp *Response, ended time.Time, errored bool) {
+	if s.origin.IsZero() {
+		s.origin = resp.started
+	}
+	b := s.bucket(ended)
+	b.Requests++
+	if errored {
+		b.Errors++
+	}
+	b.StatusSum.record(resp.statusCode)
+	b.Times.Record(resp.duration)
+}
+
+// merge accumulates the buckets of the provided time series, realigned on the origin of this one.
+func (s *TimeSeries) merge(o *TimeSeries) {
+	if o.origin.IsZero() {
+		return
+	}
+	if s.origin.IsZero() {
+		s.origin = o.origin
+	}
+	for s.Interval.Duration < o.Interval.Duration {
+		s.coarsen()
+	}
+	for _, ob := range o.Buckets {
+		s.bucket(o.origin.Add(ob.Offset.Duration)).merge(ob)
+	}
+}
+
+// merge accumulates the statistics of the provided bucket.
+func (b *Bucket) merge(o *Bucket) {
+	b.Requests += o.Requests
+	b.Errors += o.Errors
+	b.StatusSum.merge(o.StatusSum)
+	b.Times.Merge(o.Times)
+}
+
+// coarsen doubles the interval of the time series, merging its buckets two by two.
+func (s *TimeSeries) coarsen() {
+	s.Interval.Duration *= 2
+	merged := make([]*Bucket, 0, (len(s.Buckets)+1)/2)
+	for bno := 0; bno < len(s.Buckets); bno += 2 {
+		// The offset of the first bucket of each pair is that of the merged bucket.
+		b := s.Buckets[bno]
+		if bno+1 < len(s.Buckets) {
+			b.merge(s.Buckets[bno+1])
+		}
+		merged = append(merged, b)
+	}
+	s.Buckets = merged
+}
+
+// bucket returns the bucket for the provided completion time, adding buckets as needed and coarsening
+// the time series once it would have more than maxBuckets.
+func (s *TimeSeries) bucket(ended time.Time) *Bucket {
+	bno := int(ended.Sub(s.origin) / s.Interval.Duration)
+	if bno < 0 {
+		bno = 0
+	}
+	for bno >= maxBuckets {
+		s.coarsen()
+		bno = int(ended.Sub(s.origin) / s.Interval.Duration)
+	}
+	for len(s.Buckets) <= bno {
+		s.Buckets = append(s.Buckets, &Bucket{Offset: Duration{Duration: s.Interval.Duration * time.Duration(len(s.Buckets))},
+			StatusSum: &StatusSummary{}, Times: newPercentages(bucketFigures)})
+	}
+	return s.Buckets[bno]
+}
+
+// SetTimeState sets the state of the response times of each bucket.
+func (s *TimeSeries) SetTimeState(critical, warning time.Duration) {
+	for _, b := range s.Buckets {
+		b.Times.SetState(critical, warning)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTimeSeries(t *testing.T) {
+	Convey("Testing the time series of responses", t, func() {
+		defer func(interval time.Duration) { bucketInterval = interval }(bucketInterval)
+		bucketInterval = time.Millisecond * 500
+		start := time.Now()
+		s := newTimeSeries()
+		So(s.Interval.Duration, ShouldEqual, time.Millisecond*500)
+		s.add(&Response{statusCode: 200, started: start, duration: time.Millisecond * 100}, start.Add(time.Millisecond*100), false)
+		s.add(&Response{statusCode: 503, started: start.Add(time.Millisecond * 300), duration: time.Millisecond * 300},
+			start.Add(time.Millisecond*600), true)
+		s.add(&Response{statusCode: -1, started: start.Add(time.Millisecond * 1200)}, start.Add(time.Millisecond*1200), true)
+		So(len(s.Buckets), ShouldEqual, 3)
+		So(s.Buckets[0].Requests, ShouldEqual, 1)
+		So(s.Buckets[0].StatusSum, ShouldResemble, &StatusSummary{S2xx: 1})
+		So(s.Buckets[1].Offset.Duration, ShouldEqual, time.Millisecond*500)
+		So(s.Buckets[1].Errors, ShouldEqual, 1)
+		So(s.Buckets[1].Times.Len(), ShouldEqual, 1)
+		So(s.Buckets[2].StatusSum.None, ShouldEqual, 1)
+
+		Convey("Merging realigns the buckets on the earliest origin", func() {
+			o := newTimeSeries()
+			o.add(&Response{statusCode: 404, started: start.Add(time.Second), duration: time.Millisecond * 50},
+				start.Add(time.Millisecond*1050), false)
+			s.merge(o)
+			So(len(s.Buckets), ShouldEqual, 3)
+			So(s.Buckets[2].Requests, ShouldEqual, 2)
+			So(s.Buckets[2].StatusSum, ShouldResemble, &StatusSummary{None: 1, S4xx: 1})
+			s.merge(newTimeSeries())
+			So(len(s.Buckets), ShouldEqual, 3)
+		})
+
+		Convey("Long runs are merged into coarser buckets", func() {
+			for i := 0; i < maxBuckets*3; i++ {
+				s.add(&Response{statusCode: 200, duration: time.Millisecond}, start.Add(bucketInterval*time.Duration(i)), false)
+			}
+			So(len(s.Buckets), ShouldBeLessThanOrEqualTo, maxBuckets)
+			So(s.Interval.Duration, ShouldEqual, bucketInterval*4)
+			So(s.Buckets[1].Offset.Duration, ShouldEqual, bucketInterval*4)
+			requests := 0
+			for _, b := range s.Buckets {
+				requests += b.Requests
+			}
+			So(requests, ShouldEqual, maxBuckets*3+3)
+			So(s.Buckets[0].Requests, ShouldEqual, 4+3)
+
+			Convey("and finer time series are merged at the coarser interval", func() {
+				o := newTimeSeries()
+				o.merge(s)
+				So(o.Interval.Duration, ShouldEqual, s.Interval.Duration)
+				So(len(o.Buckets), ShouldEqual, len(s.Buckets))
+				So(o.Buckets[0].Requests, ShouldEqual, 7)
+			})
+		})
+
+		Convey("The buckets are serialized with the result", func() {
+			s.SetTimeState(time.Second, time.Millisecond*200)
+			b, err := xml.Marshal(s)
+			So(err, ShouldBeNil)
+			So(string(b), ShouldStartWith, `<TimeSeries interval="500ms"><bucket requests="1" errors="0"><statuses errored="0" s1xx="0" s2xx="1"`)
+			So(string(b), ShouldContainSubstring, `<bucket offset="500ms" requests="1" errors="1">`)
+			So(string(b), ShouldContainSubstring, `state="warning"`)
+		})
+	})
+}
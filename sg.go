@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"github.com/op/go-logging"
 	"os"
+	"strings"
 	"sync"
+	"time"
 )
 
 // log is the logger, duh.
@@ -19,7 +21,40 @@ var profileFile string
 var completionWg sync.WaitGroup
 
 // totalSentRequests stores the total number of sent requests.
-var totalSentRequests int
+var totalSentRequests int64
+
+// outputFormat stores the format of the results: xml, json or both.
+var outputFormat string
+
+// junitFile stores the filename of the JUnit report, if any.
+var junitFile string
+
+// htmlFile stores the filename of the self-contained HTML report, if any.
+var htmlFile string
+
+// tuiEnabled stores whether to render a live dashboard to the terminal during the run.
+var tuiEnabled bool
+
+// dashboard is the live dashboard, only set if enabled.
+var dashboard *Dashboard
+
+// metricsAddr stores the address on which to expose the Prometheus metrics, if any.
+var metricsAddr string
+
+// metrics are the live metrics of the run, only set if exposed.
+var metrics *Metrics
+
+// sinkURL stores the URL of the sink to which each response is streamed, if any.
+var sinkURL string
+
+// rawLogFile stores the filename of the raw log of every request, as CSV or NDJSON, if any.
+var rawLogFile string
+
+// streamer streams the responses to the sink and the raw log, only set if either is configured.
+var streamer *Streamer
+
+// historyDir stores the directory in which the results of every run are kept, if any.
+var historyDir string
 
 // profile stores the profile to stress.
 var profile *Profile
@@ -27,29 +62,150 @@ var profile *Profile
 // init parses the flags.
 func init() {
 	totalSentRequests = 0
-	flag.StringVar(&profileFile, "profile", "", "path to stress profile")
+	flag.StringVar(&profileFile, "profile", "", "path to stress profile, in XML, JSON (.json) or YAML (.yaml or .yml)")
+	flag.StringVar(&outputFormat, "format", "xml", "format of the results: xml, json or both")
+	flag.StringVar(&junitFile, "junit", "", "path to a JUnit report of the results, e.g. for CI servers")
+	flag.StringVar(&htmlFile, "html", "", "path to a self-contained HTML report of the results, with charts")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "address on which to expose live Prometheus metrics, e.g. :9100")
+	flag.StringVar(&sinkURL, "sink", "", "stream each response to influx+udp://host:8089, influx+http://host:8086/write?db=sg or statsd://host:8125")
+	flag.StringVar(&rawLogFile, "requests-log", "", "path to a raw log of every request, as .csv or .ndjson")
+	flag.StringVar(&historyDir, "history", "", "directory in which to keep the results of every run, for sg history")
+	flag.Var(variableOverrides, "var", "set a variable of the profile, as name=value (repeatable)")
+	flag.BoolVar(&tuiEnabled, "tui", false, "render a live dashboard of the ongoing requests to the terminal")
 	logFormat := logging.MustStringFormatter("%{color}%{time:15:04:05.000} %{shortfunc} ▶ %{level}%{color:reset} %{message}")
 	logging.SetBackend(logging.NewBackendFormatter(logging.NewLogBackend(os.Stderr, "", 0), logFormat))
 }
 
 func main() {
 	flag.Parse()
+	if flag.NArg() > 0 {
+		os.Exit(runCommand(flag.Args()))
+	}
+	if outputFormat != "xml" && outputFormat != "json" && outputFormat != "both" {
+		fmt.Fprintf(os.Stderr, "invalid format `%s`: expected xml, json or both\n", outputFormat)
+		os.Exit(2)
+	}
 	err := loadProfile(profileFile)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
-		return
+		os.Exit(2)
+	}
+	if metricsAddr != "" {
+		metrics = newMetrics()
+		if err := metrics.Serve(metricsAddr); err != nil {
+			fmt.Fprintf(os.Stderr, "could not expose the metrics on %s: %s\n", metricsAddr, err)
+			os.Exit(2)
+		}
+		log.Notice("Exposing metrics on %s/metrics.", metricsAddr)
+	}
+	sinks := []Sink{}
+	destinations := []string{}
+	if sinkURL != "" {
+		sink, err := newSink(sinkURL)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not open the sink: %s\n", err)
+			os.Exit(2)
+		}
+		sinks = append(sinks, sink)
+		destinations = append(destinations, sinkURL)
+	}
+	if rawLogFile != "" {
+		sink, err := newFileSink(rawLogFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "could not open the raw log: %s\n", err)
+			os.Exit(2)
+		}
+		sinks = append(sinks, sink)
+		destinations = append(destinations, rawLogFile)
+	}
+	if len(sinks) > 0 {
+		streamer = newStreamer(sinks...)
+	}
+	if tuiEnabled {
+		dashboard = newDashboard(os.Stdout)
+		dashboard.Start()
 	}
 	stress(profile) // blocking call
-	log.Notice("Saved output to %s.", saveResult(profile, profileFile))
+	if dashboard != nil {
+		dashboard.Stop()
+	}
+	if streamer != nil {
+		if err := streamer.Close(); err != nil {
+			log.Critical("could not stream all the results: %s", err)
+		} else {
+			log.Notice("Streamed the results to %s.", strings.Join(destinations, " and "))
+		}
+	}
+	log.Notice("Saved output to %s.", strings.Join(saveResult(profile, profileFile), " and "))
+	if historyDir != "" {
+		if filename, err := saveHistory(profile, historyDir, time.Now()); err != nil {
+			log.Critical("could not save the result to the history: %s", err)
+		} else {
+			log.Notice("Saved result to the history as %s.", filename)
+		}
+	}
+	if junitFile != "" {
+		if err := saveJUnitResult(profile, junitFile); err != nil {
+			log.Critical("could not save the JUnit report: %s", err)
+		} else {
+			log.Notice("Saved JUnit report to %s.", junitFile)
+		}
+	}
+	if htmlFile != "" {
+		if err := saveHTMLResult(profile, htmlFile); err != nil {
+			log.Critical("could not save the HTML report: %s", err)
+		} else {
+			log.Notice("Saved HTML report to %s.", htmlFile)
+		}
+	}
+	if !logSLOs(profile) {
+		os.Exit(1)
+	}
+}
+
+// runCommand runs the provided command, e.g. `sg compare old.xml new.xml`, and returns its exit code.
+func runCommand(args []string) int {
+	switch args[0] {
+	case "compare":
+		return compareCommand(args[1:], os.Stdout)
+	case "history":
+		return historyCommand(args[1:], os.Stdout)
+	case "validate":
+		return validateCommand(args[1:], os.Stdout)
+	case "convert":
+		return convertCommand(args[1:], os.Stdout)
+	}
+	fmt.Fprintf(os.Stderr, "unknown command `%s`: expected compare, convert, history or validate\n", args[0])
+	return 2
 }
 
 func stress(profile *Profile) {
 	for _, test := range profile.Tests {
 		log.Notice("Starting test %s.", test)
-		for _, r := range test.Requests {
-			r.Spawn(nil, &completionWg)
+		started := time.Now()
+		if dashboard != nil {
+			dashboard.Watch(test)
+		}
+		if metrics != nil {
+			metrics.Watch(test)
+		}
+		if streamer != nil {
+			streamer.Watch(test)
+		}
+		if test.Scenario != nil {
+			log.Notice("Running scenario with %s.", test.Scenario)
+			test.Scenario.Run(test.Requests, &completionWg)
+		} else {
+			for _, r := range test.Requests {
+				r.Spawn(nil, &completionWg)
+			}
+		}
+		if test.Mix != nil {
+			log.Notice("Running %s.", test.Mix)
+			test.Mix.Run(&completionWg)
 		}
 		completionWg.Wait()
+		test.elapsed = time.Since(started)
 	}
 
 	log.Notice("Sent a total of %d requests.", totalSentRequests)
@@ -146,7 +146,7 @@ func TestStressGauge(t *testing.T) {
 		}
 		stress(&profile)
 		// Let's now save the profile locally and test that all the information is stored correctly.
-		filename := saveResult(&profile, "sg_output_test")
+		filename := saveResult(&profile, "sg_output_test")[0]
 		// And let's load this profile and check the values are those of the saved profile.
 		type SGResult struct {
 			LoadedProfile Profile `xml:"Profile"`
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// influxBatchSize is the number of samples posted at once to InfluxDB over HTTP.
+var influxBatchSize = 500
+
+// streamerBuffer is the number of samples waiting to be sent to each sink, beyond which samples are dropped
+// rather than slowing down the collection of the responses, unless the sink is lossless.
+var streamerBuffer = 10000
+
+// Sample is a completed response, as streamed to a sink.
+type Sample struct {
+	Test          string
+	Path          string // Chain of the requests from the top level one to this one, e.g. "GET /login > GET /items".
+	Method        string
+	URL           string // URL of the request as defined in the profile.
+	URI           string // URL which was generated for this sample.
+	Status        int    // Status code of the response, or -1 if no response was received.
+	ContentLength int64  // Content length of the response, or -1 if unknown.
+	Errored       bool
+	Error         string // Why the request failed or the failed assertions, if any.
+	Duration      time.Duration
+	Sent          int64 // Bytes of the request body.
+	Received      int64 // Bytes of the response body.
+	Started       time.Time
+	Ended         time.Time
+}
+
+// Sink receives the samples of the run as they complete, e.g. to keep a history in a time-series database.
+// Samples are sent one at a time, so implementations need not be safe for concurrent use.
+type Sink interface {
+	Send(sample *Sample) error
+	Close() error // Flushes any buffered sample.
+}
+
+// LosslessSink is a sink which must receive every sample, e.g. the raw log: the responses wait for it to catch up
+// rather than its samples being dropped.
+type LosslessSink interface {
+	Sink
+	lossless()
+}
+
+// newSink returns the sink described by the provided URL:
+// influx+udp://host:8089, influx+http://host:8086/write?db=sg (or influx+https) and statsd://host:8125/prefix.
+func newSink(spec string) (Sink, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "influx+udp":
+		conn, err := net.Dial("udp", u.Host)
+		if err != nil {
+			return nil, err
+		}
+		return &InfluxSink{conn: conn}, nil
+	case "influx+http", "influx+https":
+		endpoint := *u
+		endpoint.Scheme = strings.TrimPrefix(u.Scheme, "influx+")
+		return &InfluxSink{endpoint: endpoint.String()}, nil
+	case "statsd":
+		conn, err := net.Dial("udp", u.Host)
+		if err != nil {
+			return nil, err
+		}
+		prefix := strings.Trim(u.Path, "/")
+		if prefix == "" {
+			prefix = "sg"
+		}
+		return &StatsDSink{conn: conn, prefix: prefix}, nil
+	}
+	return nil, fmt.Errorf("unsupported sink `%s`: expected influx+udp, influx+http, influx+https or statsd", spec)
+}
+
+// InfluxSink writes each sample as a point of the sg_response measurement in the InfluxDB line protocol.
+// Over UDP, each point is a datagram. Over HTTP, points are posted in batches.
+type InfluxSink struct {
+	conn     net.Conn // Set for UDP.
+	endpoint string   // Set for HTTP.
+	batch    bytes.Buffer
+	batched  int
+}
+
+// influxTagEscaper escapes the tag values of the line protocol.
+var influxTagEscaper = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+
+// Send implements the Sink interface.
+func (s *InfluxSink) Send(sample *Sample) error {
+	line := fmt.Sprintf("sg_response,test=%s,method=%s,url=%s,status=%d duration_ms=%s,sent=%di,received=%di,errored=%t %d\n",
+		influxTagEscaper.Replace(sample.Test), sample.Method, influxTagEscaper.Replace(sample.URL), sample.Status,
+		strconv.FormatFloat(milliseconds(sample.Duration), 'f', -1, 64), sample.Sent, sample.Received, sample.Errored, sample.Ended.UnixNano())
+	if s.conn != nil {
+		_, err := s.conn.Write([]byte(line))
+		return err
+	}
+	s.batch.WriteString(line)
+	s.batched++
+	if s.batched >= influxBatchSize {
+		return s.flush()
+	}
+	return nil
+}
+
+// flush posts the batched points.
+func (s *InfluxSink) flush() error {
+	if s.batched == 0 {
+		return nil
+	}
+	defer func() {
+		s.batch.Reset()
+		s.batched = 0
+	}()
+	resp, err := http.Post(s.endpoint, "text/plain; charset=utf-8", &s.batch)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("could not write %d point(s) to %s: got status %d", s.batched, s.endpoint, resp.StatusCode)
+	}
+	return nil
+}
+
+// Close implements the Sink interface.
+func (s *InfluxSink) Close() error {
+	if s.conn != nil {
+		return s.conn.Close()
+	}
+	return s.flush()
+}
+
+// StatsDSink writes each sample as a timer and counters, in a single datagram per sample:
+// <prefix>.<test>.<method>.<url>.response_time, then .status.<code> and .errors if the response errored.
+type StatsDSink struct {
+	conn   net.Conn
+	prefix string
+}
+
+// statsdInvalid matches the characters which are replaced in the StatsD bucket names.
+var statsdInvalid = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// Send implements the Sink interface.
+func (s *StatsDSink) Send(sample *Sample) error {
+	name := strings.Join([]string{s.prefix, statsdInvalid.ReplaceAllString(sample.Test, "_"), sample.Method,
+		strings.Trim(statsdInvalid.ReplaceAllString(sample.URL, "_"), "_")}, ".")
+	status := "errored"
+	if sample.Status != -1 {
+		status = strconv.Itoa(sample.Status)
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s.response_time:%s|ms\n%s.status.%s:1|c", name, strconv.FormatFloat(milliseconds(sample.Duration), 'f', -1, 64), name, status)
+	if sample.Errored {
+		fmt.Fprintf(&buf, "\n%s.errors:1|c", name)
+	}
+	_, err := s.conn.Write(buf.Bytes())
+	return err
+}
+
+// Close implements the Sink interface.
+func (s *StatsDSink) Close() error {
+	return s.conn.Close()
+}
+
+// Streamer streams the responses of the watched requests to sinks. Each sink is sent its samples from its
+// own background go routine, so that a slow sink neither changes the load being measured nor holds up the others.
+type Streamer struct {
+	queues   []*sinkQueue
+	mutex    sync.Mutex
+	requests map[*Request]*streamedRequest
+	closed   bool
+}
+
+// sinkQueue is the samples waiting to be sent to a sink.
+type sinkQueue struct {
+	sink     Sink
+	samples  chan *Sample  // Samples waiting to be sent.
+	sent     chan struct{} // Closed once all the samples were sent.
+	dropped  int           // Number of samples dropped because the buffer was full.
+	failures int           // Number of samples which could not be sent, only updated by the background go routine.
+}
+
+// streamedRequest is the test and the path in the request tree of a watched request.
+type streamedRequest struct {
+	test string
+	path string
+}
+
+// newStreamer returns a streamer to the provided sinks.
+func newStreamer(sinks ...Sink) *Streamer {
+	s := &Streamer{requests: make(map[*Request]*streamedRequest)}
+	for _, sink := range sinks {
+		q := &sinkQueue{sink: sink, samples: make(chan *Sample, streamerBuffer), sent: make(chan struct{})}
+		s.queues = append(s.queues, q)
+		go q.send()
+	}
+	return s
+}
+
+// send sends the samples to the sink until the streamer is closed.
+// Only the first error is logged, in order not to flood the log if the sink is down.
+func (q *sinkQueue) send() {
+	for sample := range q.samples {
+		if err := q.sink.Send(sample); err != nil {
+			if q.failures == 0 {
+				log.Error("could not stream the results: %s", err)
+			}
+			q.failures++
+		}
+	}
+	close(q.sent)
+}
+
+// Watch registers the requests of the provided test, including children and mix entries.
+// It must be called before the test starts.
+func (s *Streamer) Watch(test *StressTest) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var visit func(requests []*Request, parent string)
+	visit = func(requests []*Request, parent string) {
+		for _, r := range requests {
+			path := fmt.Sprintf("%s %s", r.Method, r.URL)
+			if parent != "" {
+				path = parent + " > " + path
+			}
+			s.requests[r] = &streamedRequest{test: test.Name, path: path}
+			visit(r.Children, path)
+		}
+	}
+	visit(test.Requests, "")
+	if test.Mix != nil {
+		visit(test.Mix.Requests, "")
+	}
+}
+
+// observe queues the provided response of a request for the sinks, if that request is watched. The sample
+// is dropped for the sinks which already have too many waiting, except for lossless sinks which it waits for.
+func (s *Streamer) observe(r *Request, resp *Response) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	watched, exists := s.requests[r]
+	if !exists || s.closed {
+		return
+	}
+	sample := &Sample{Test: watched.test, Path: watched.path, Method: r.Method, URL: r.URL.String(), URI: resp.uri,
+		Status: resp.statusCode, ContentLength: resp.contentLength, Errored: resp.errored(), Error: resp.err,
+		Duration: resp.duration, Sent: resp.sent, Received: resp.received, Started: resp.started, Ended: resp.started.Add(resp.duration)}
+	if sample.Error == "" {
+		messages := []string{}
+		for _, failure := range resp.failures {
+			messages = append(messages, fmt.Sprintf("%s: %s", failure.Check, failure.Message))
+		}
+		sample.Error = strings.Join(messages, "; ")
+	}
+	for _, q := range s.queues {
+		if _, lossless := q.sink.(LosslessSink); lossless {
+			q.samples <- sample
+			continue
+		}
+		select {
+		case q.samples <- sample:
+		default:
+			if q.dropped == 0 {
+				log.Error("dropping samples because a sink cannot keep up")
+			}
+			q.dropped++
+		}
+	}
+}
+
+// Close sends the queued samples and closes all the sinks, even if some fail to. It returns an error
+// combining the problems of every sink, and whether any sample could not be sent.
+func (s *Streamer) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.closed {
+		s.closed = true
+		for _, q := range s.queues {
+			close(q.samples)
+		}
+	}
+	problems := []string{}
+	dropped, failures := 0, 0
+	for _, q := range s.queues {
+		<-q.sent
+		if err := q.sink.Close(); err != nil {
+			problems = append(problems, err.Error())
+		}
+		dropped += q.dropped
+		failures += q.failures
+	}
+	if dropped > 0 {
+		problems = append(problems, fmt.Sprintf("%d sample(s) were dropped because the sinks could not keep up", dropped))
+	}
+	if failures > 0 {
+		problems = append(problems, fmt.Sprintf("%d sample(s) could not be sent", failures))
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// receive returns the next datagram received by the listener.
+func receive(conn net.PacketConn) string {
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		return err.Error()
+	}
+	return string(buf[:n])
+}
+
+// blockingSink is a sink whose Send blocks until it is released, and whose Close fails if closeErr is set.
+type blockingSink struct {
+	release  chan struct{}
+	received int
+	closed   bool
+	closeErr error
+}
+
+func (s *blockingSink) Send(sample *Sample) error {
+	<-s.release
+	s.received++
+	return nil
+}
+
+func (s *blockingSink) Close() error {
+	s.closed = true
+	return s.closeErr
+}
+
+// losslessSink is a blocking sink which must receive every sample.
+type losslessSink struct {
+	blockingSink
+}
+
+func (s *losslessSink) lossless() {}
+
+func TestSinks(t *testing.T) {
+	Convey("Testing the streaming of the results to a sink", t, func() {
+		ended := time.Unix(1500000000, 5)
+		sample := &Sample{Test: "Sink test", Method: "GET", URL: "http://example.org/a,b?c=d", Status: 503, Errored: true,
+			Duration: time.Millisecond * 12, Sent: 5, Received: 10, Ended: ended}
+		listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		defer listener.Close()
+
+		Convey("InfluxDB line protocol over UDP", func() {
+			sink, err := newSink("influx+udp://" + listener.LocalAddr().String())
+			So(err, ShouldBeNil)
+			So(sink.Send(sample), ShouldBeNil)
+			So(receive(listener), ShouldEqual, `sg_response,test=Sink\ test,method=GET,url=http://example.org/a\,b?c\=d,status=503 `+
+				"duration_ms=12,sent=5i,received=10i,errored=true 1500000000000000005\n")
+			So(sink.Close(), ShouldBeNil)
+		})
+
+		Convey("InfluxDB line protocol over HTTP, in batches", func() {
+			defer func(size int) { influxBatchSize = size }(influxBatchSize)
+			influxBatchSize = 2
+			posts := []string{}
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				posts = append(posts, r.URL.RequestURI()+"\n"+string(body))
+				w.WriteHeader(204)
+			}))
+			defer ts.Close()
+			sink, err := newSink(strings.Replace(ts.URL, "http://", "influx+http://", 1) + "/write?db=sg")
+			So(err, ShouldBeNil)
+			for i := 0; i < 3; i++ {
+				So(sink.Send(sample), ShouldBeNil)
+			}
+			So(len(posts), ShouldEqual, 1)
+			So(strings.Count(posts[0], "sg_response,"), ShouldEqual, 2)
+			So(posts[0], ShouldStartWith, "/write?db=sg\n")
+			So(sink.Close(), ShouldBeNil)
+			So(len(posts), ShouldEqual, 2)
+			So(strings.Count(posts[1], "sg_response,"), ShouldEqual, 1)
+			// Nothing is posted if there is nothing left.
+			So(sink.Close(), ShouldBeNil)
+			So(len(posts), ShouldEqual, 2)
+
+			Convey("A failed write is an error", func() {
+				failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(400)
+				}))
+				defer failing.Close()
+				sink, _ := newSink(strings.Replace(failing.URL, "http://", "influx+http://", 1) + "/write")
+				sink.Send(sample)
+				So(sink.Close().Error(), ShouldContainSubstring, "could not write 1 point(s)")
+			})
+		})
+
+		Convey("StatsD over UDP", func() {
+			sink, err := newSink("statsd://" + listener.LocalAddr().String() + "/loadtests")
+			So(err, ShouldBeNil)
+			So(sink.Send(sample), ShouldBeNil)
+			So(receive(listener), ShouldEqual, "loadtests.Sink_test.GET.http_example_org_a_b_c_d.response_time:12|ms\n"+
+				"loadtests.Sink_test.GET.http_example_org_a_b_c_d.status.503:1|c\n"+
+				"loadtests.Sink_test.GET.http_example_org_a_b_c_d.errors:1|c")
+			sample.Status = -1
+			sample.Errored = false
+			sink.(*StatsDSink).prefix = "sg"
+			So(sink.Send(sample), ShouldBeNil)
+			So(receive(listener), ShouldEndWith, "sg.Sink_test.GET.http_example_org_a_b_c_d.status.errored:1|c")
+			So(sink.Close(), ShouldBeNil)
+		})
+
+		Convey("Unknown sinks are rejected", func() {
+			_, err := newSink("graphite://localhost:2003")
+			So(err, ShouldNotBeNil)
+			_, err = newSink("%")
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("The streamer sends the responses of the watched requests", func() {
+			sink, _ := newSink("influx+udp://" + listener.LocalAddr().String())
+			s := newStreamer(sink)
+			r := &Request{Method: "GET", URL: &URL{Base: "http://example.org/"}}
+			s.Watch(&StressTest{Name: "Streamed", Requests: []*Request{r}})
+			s.observe(&Request{Method: "GET", URL: &URL{Base: "http://example.org/unwatched"}}, &Response{statusCode: 200})
+			s.observe(r, &Response{statusCode: 200, started: ended, duration: time.Millisecond, received: 3})
+			So(receive(listener), ShouldStartWith, "sg_response,test=Streamed,method=GET,url=http://example.org/,status=200 duration_ms=1,sent=0i,received=3i,errored=false ")
+			So(s.Close(), ShouldBeNil)
+		})
+
+		Convey("All the sinks are closed even if one fails to", func() {
+			failing := &blockingSink{release: make(chan struct{}), closeErr: errors.New("connection reset")}
+			other := &blockingSink{release: make(chan struct{}), closeErr: errors.New("disk full")}
+			s := newStreamer(failing, other)
+			err := s.Close()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "connection reset; disk full")
+			So(failing.closed, ShouldBeTrue)
+			So(other.closed, ShouldBeTrue)
+		})
+
+		Convey("A slow sink does not block the responses, which are dropped once the buffer is full", func() {
+			defer func(buffer int) { streamerBuffer = buffer }(streamerBuffer)
+			streamerBuffer = 2
+			sink := &blockingSink{release: make(chan struct{})}
+			s := newStreamer(sink)
+			r := &Request{Method: "GET", URL: &URL{Base: "http://example.org/"}}
+			s.Watch(&StressTest{Name: "Slow", Requests: []*Request{r}})
+			observed := make(chan struct{})
+			go func() {
+				for i := 0; i < 10; i++ {
+					s.observe(r, &Response{statusCode: 200})
+				}
+				close(observed)
+			}()
+			select {
+			case <-observed:
+			case <-time.After(time.Second):
+				t.Fatal("observing the responses blocked on the sink")
+			}
+			close(sink.release)
+			err := s.Close()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "were dropped because the sinks could not keep up")
+			So(sink.received, ShouldBeBetweenOrEqual, 2, 3)
+			So(sink.closed, ShouldBeTrue)
+		})
+
+		Convey("Lossless sinks receive every response, even if another sink is slow", func() {
+			defer func(buffer int) { streamerBuffer = buffer }(streamerBuffer)
+			streamerBuffer = 2
+			slow := &blockingSink{release: make(chan struct{})}
+			raw := &losslessSink{blockingSink{release: make(chan struct{})}}
+			close(raw.release)
+			s := newStreamer(slow, raw)
+			r := &Request{Method: "GET", URL: &URL{Base: "http://example.org/"}}
+			s.Watch(&StressTest{Name: "Lossless", Requests: []*Request{r}})
+			for i := 0; i < 10; i++ {
+				s.observe(r, &Response{statusCode: 200})
+			}
+			close(slow.release)
+			err := s.Close()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldContainSubstring, "were dropped because the sinks could not keep up")
+			So(raw.received, ShouldEqual, 10)
+			So(slow.received, ShouldBeBetweenOrEqual, 2, 3)
+		})
+	})
+}
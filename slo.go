@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sloRule matches rules such as "p95 < 300ms", "error rate < 0.5%" or "throughput >= 500rps".
+var sloRule = regexp.MustCompile(`^\s*([a-z][a-z0-9._ ]*?)\s*(<=|>=|<|>|\ble\b|\bge\b|\blt\b|\bgt\b)\s*(\S.*?)\s*$`)
+
+// SLO is a service level objective which the results of a test or a request must meet.
+// After the run, it also stores the actual value and whether the objective was met.
+type SLO struct {
+	Rule      string `xml:",chardata"`
+	Actual    string `xml:"actual,attr,omitempty"`
+	Status    string `xml:"status,attr,omitempty"` // Either passed or failed, once evaluated.
+	metric    string
+	operator  string
+	threshold float64 // Nanoseconds for response times, percent for the error rate, and requests per second for the throughput.
+}
+
+// sloStats are the statistics against which an SLO is evaluated.
+type sloStats struct {
+	times      *Percentages
+	count      int
+	errors     int
+	throughput float64
+}
+
+// Validate confirms that an SLO is correctly defined and initializes variables, or returns the problem.
+func (s *SLO) Validate() error {
+	match := sloRule.FindStringSubmatch(strings.ToLower(s.Rule))
+	if match == nil {
+		return fmt.Errorf("invalid SLO `%s`, expected e.g. `p95 < 300ms`", s.Rule)
+	}
+	s.metric = strings.Replace(match[1], " ", "_", -1)
+	s.operator = map[string]string{"lt": "<", "le": "<=", "gt": ">", "ge": ">="}[match[2]]
+	if s.operator == "" {
+		s.operator = match[2]
+	}
+	value := strings.Replace(match[3], " ", "", -1)
+	var err error
+	switch {
+	case s.isTime():
+		if s.metric != "mean" && s.metric != "shortest" && s.metric != "longest" {
+			var perc float64
+			if perc, err = strconv.ParseFloat(s.metric[1:], 64); err != nil || perc <= 0 || perc >= 100 {
+				return fmt.Errorf("invalid percentile in SLO `%s`", s.Rule)
+			}
+		}
+		var threshold time.Duration
+		threshold, err = time.ParseDuration(value)
+		s.threshold = float64(threshold)
+	case s.metric == "error_rate":
+		s.threshold, err = strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	case s.metric == "throughput":
+		var rate Rate
+		rate, err = ParseRate(strings.TrimSuffix(value, "rps"))
+		s.threshold = rate.PerSecond()
+	default:
+		return fmt.Errorf("unknown metric `%s` in SLO `%s`", match[1], s.Rule)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid threshold in SLO `%s`: %s", s.Rule, err)
+	}
+	return nil
+}
+
+// MarshalJSON implements the json.Marshaler interface: profiles only define the rule of an SLO.
+func (s SLO) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Rule)
+}
+
+// UnmarshalJSON unmarshals the rule of an SLO from a JSON string.
+func (s *SLO) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &s.Rule)
+}
+
+// MarshalYAML implements the yaml.Marshaler interface: profiles only define the rule of an SLO.
+func (s SLO) MarshalYAML() (interface{}, error) {
+	return s.Rule, nil
+}
+
+// UnmarshalYAML unmarshals the rule of an SLO from a YAML string.
+func (s *SLO) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	return unmarshal(&s.Rule)
+}
+
+// isTime returns whether this SLO is on response times.
+func (s *SLO) isTime() bool {
+	return s.metric == "mean" || s.metric == "shortest" || s.metric == "longest" ||
+		(len(s.metric) > 1 && s.metric[0] == 'p' && s.metric[1] >= '0' && s.metric[1] <= '9')
+}
+
+// Evaluate checks this SLO against the provided statistics, and returns whether it was met.
+func (s *SLO) Evaluate(stats *sloStats) bool {
+	var actual float64
+	switch {
+	case s.metric == "mean":
+		actual = float64(stats.times.Mean())
+	case s.metric == "shortest":
+		actual = float64(stats.times.Percentage(0).Duration)
+	case s.metric == "longest":
+		actual = float64(stats.times.Percentage(100).Duration)
+	case s.isTime():
+		perc, _ := strconv.ParseFloat(s.metric[1:], 64)
+		actual = float64(stats.times.Quantile(perc).Duration)
+	case s.metric == "error_rate":
+		if stats.count > 0 {
+			actual = float64(stats.errors) / float64(stats.count) * 100
+		}
+	case s.metric == "throughput":
+		actual = stats.throughput
+	}
+	var passed bool
+	switch s.operator {
+	case "<":
+		passed = actual < s.threshold
+	case "<=":
+		passed = actual <= s.threshold
+	case ">":
+		passed = actual > s.threshold
+	case ">=":
+		passed = actual >= s.threshold
+	}
+	switch {
+	case s.isTime():
+		s.Actual = time.Duration(actual).String()
+	case s.metric == "error_rate":
+		s.Actual = strconv.FormatFloat(actual, 'f', 3, 64) + "%"
+	default:
+		s.Actual = strconv.FormatFloat(actual, 'f', 2, 64) + "rps"
+	}
+	s.Status = "failed"
+	if passed {
+		s.Status = "passed"
+	}
+	return passed
+}
+
+// EvaluateSLOs evaluates the SLOs of this test on all its results, and those of each result.
+// It returns the number of SLOs which were not met.
+func (t *StressTest) EvaluateSLOs() (failed int) {
+	total := &sloStats{times: NewPercentages(nil)}
+	var visit func(results []*Result)
+	visit = func(results []*Result) {
+		for _, result := range results {
+			stats := &sloStats{times: result.Times, count: result.Times.Len(), errors: result.Errors, throughput: result.Throughput}
+			for _, slo := range result.SLOs {
+				if !slo.Evaluate(stats) {
+					failed++
+				}
+			}
+			total.times.Merge(result.Times)
+			total.count += stats.count
+			total.errors += stats.errors
+			visit(result.Spawned)
+		}
+	}
+	visit(t.Result)
+	if t.elapsed > 0 {
+		total.throughput = float64(total.count) / t.elapsed.Seconds()
+	}
+	for _, slo := range t.SLOs {
+		if !slo.Evaluate(total) {
+			failed++
+		}
+	}
+	return
+}
+
+// logSLOs logs the outcome of all the SLOs of the profile, and returns whether they were all met.
+func logSLOs(profile *Profile) bool {
+	var passed, failed int
+	logSLO := func(where string, slo *SLO) {
+		if slo.Status == "passed" {
+			passed++
+			log.Notice("SLO PASSED: %s: %s (actual %s)", where, strings.TrimSpace(slo.Rule), slo.Actual)
+		} else {
+			failed++
+			log.Error("SLO FAILED: %s: %s (actual %s)", where, strings.TrimSpace(slo.Rule), slo.Actual)
+		}
+	}
+	var visit func(test *StressTest, results []*Result)
+	visit = func(test *StressTest, results []*Result) {
+		for _, result := range results {
+			for _, slo := range result.SLOs {
+				logSLO(fmt.Sprintf("%s %s %s", test.Name, result.Method, result.URL), slo)
+			}
+			visit(test, result.Spawned)
+		}
+	}
+	for _, test := range profile.Tests {
+		for _, slo := range test.SLOs {
+			logSLO(test.Name, slo)
+		}
+		visit(test, test.Result)
+	}
+	if passed+failed > 0 {
+		log.Notice("%d of %d SLO(s) met.", passed, passed+failed)
+	}
+	return failed == 0
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSLO(t *testing.T) {
+	Convey("Testing SLOs", t, func() {
+		Convey("Invalid SLOs should fail validation", func() {
+			for _, rule := range []string{"", "p95", "p95 300ms", "p95 = 300ms", "p100 < 1s", "p95 < 300", "latency < 1s",
+				"error rate < half", "throughput > fast"} {
+				slo := SLO{Rule: rule}
+				So(slo.Validate(), ShouldNotBeNil)
+			}
+		})
+		Convey("Valid SLOs should be parsed", func() {
+			for rule, expected := range map[string]SLO{
+				"p95 < 300ms":           {metric: "p95", operator: "<", threshold: float64(time.Millisecond * 300)},
+				" P99.9 lt 1s ":         {metric: "p99.9", operator: "<", threshold: float64(time.Second)},
+				"mean <= 50ms":          {metric: "mean", operator: "<=", threshold: float64(time.Millisecond * 50)},
+				"longest le 2s":         {metric: "longest", operator: "<=", threshold: float64(time.Second * 2)},
+				"error rate < 0.5%":     {metric: "error_rate", operator: "<", threshold: 0.5},
+				"error_rate < 1":        {metric: "error_rate", operator: "<", threshold: 1},
+				"throughput > 500rps":   {metric: "throughput", operator: ">", threshold: 500},
+				"throughput ge 12000/m": {metric: "throughput", operator: ">=", threshold: 200},
+			} {
+				slo := SLO{Rule: rule}
+				So(slo.Validate(), ShouldBeNil)
+				expected.Rule = rule
+				So(slo, ShouldResemble, expected)
+			}
+		})
+		Convey("SLOs should be evaluated on the results of the test and of each request", func() {
+			vals := []time.Duration{}
+			for i := 1; i <= 100; i++ {
+				vals = append(vals, time.Millisecond*time.Duration(i))
+			}
+			child := &Result{Times: NewPercentages([]time.Duration{time.Second}), Errors: 1, Throughput: 1,
+				SLOs: []*SLO{{Rule: "error rate < 50%"}}}
+			top := &Result{Times: NewPercentages(vals), Errors: 0, Throughput: 100, Spawned: []*Result{child},
+				SLOs: []*SLO{{Rule: "p95 < 100ms"}, {Rule: "throughput >= 100rps"}}}
+			test := &StressTest{Name: "SLO test", Result: []*Result{top}, elapsed: time.Second * 2,
+				SLOs: []*SLO{{Rule: "longest < 1s"}, {Rule: "error rate < 1%"}, {Rule: "throughput > 50 rps"}, {Rule: "p50 < 60ms"}}}
+			for _, slo := range append(append(test.SLOs, top.SLOs...), child.SLOs...) {
+				slo.Validate()
+			}
+			So(test.EvaluateSLOs(), ShouldEqual, 2)
+			So(top.SLOs[0].Actual, ShouldEqual, "95.039ms")
+			So(top.SLOs[0].Status, ShouldEqual, "passed")
+			So(top.SLOs[1].Actual, ShouldEqual, "100.00rps")
+			So(top.SLOs[1].Status, ShouldEqual, "passed")
+			So(child.SLOs[0].Actual, ShouldEqual, "100.000%")
+			So(child.SLOs[0].Status, ShouldEqual, "failed")
+			So(test.SLOs[0].Status, ShouldEqual, "failed")
+			So(test.SLOs[1].Actual, ShouldEqual, "0.990%")
+			So(test.SLOs[1].Status, ShouldEqual, "passed")
+			So(test.SLOs[2].Actual, ShouldEqual, "50.50rps")
+			So(test.SLOs[2].Status, ShouldEqual, "passed")
+			So(test.SLOs[3].Status, ShouldEqual, "passed")
+			So(logSLOs(&Profile{Tests: []*StressTest{test}}), ShouldBeFalse)
+			So(logSLOs(&Profile{Tests: []*StressTest{{Result: []*Result{{SLOs: top.SLOs}}}}}), ShouldBeTrue)
+
+			b, _ := xml.Marshal(top.SLOs[0])
+			So(string(b), ShouldEqual, `<SLO actual="95.039ms" status="passed">p95 &lt; 100ms</SLO>`)
+		})
+	})
+}
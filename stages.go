@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/franela/goreq"
+)
+
+// stageTick is the interval at which the concurrency is adjusted during a stage.
+var stageTick = time.Millisecond * 100
+
+// Stage stores one load stage, during which the concurrency moves to the target.
+type Stage struct {
+	Duration Duration `xml:"duration,attr" json:"duration" yaml:"duration"`                   // Duration of this stage.
+	Target   int      `xml:"target,attr" json:"target" yaml:"target"`                         // Concurrency to reach by the end of this stage.
+	Mode     string   `xml:"mode,attr,omitempty" json:"mode,omitempty" yaml:"mode,omitempty"` // Either ramp (default) or step, which jumps to the target immediately.
+}
+
+// Stages are the load stages of a test or request, whose <stages> element is omitted from XML if there are none.
+type Stages []*Stage
+
+// MarshalXML implements the xml.Marshaler interface.
+func (s Stages) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(struct {
+		Stages []*Stage `xml:"stage"`
+	}{s}, start)
+}
+
+// UnmarshalXML implements the xml.Unmarshaler interface.
+func (s *Stages) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	wrapper := struct {
+		Stages []*Stage `xml:"stage"`
+	}{}
+	err := d.DecodeElement(&wrapper, &start)
+	*s = append(*s, wrapper.Stages...)
+	return err
+}
+
+// Validate confirms that a stage is correctly defined, and returns the first problem otherwise.
+func (s *Stage) Validate() error {
+	if s.Duration.Duration <= 0 {
+		return errors.New("stage duration must be positive")
+	}
+	if s.Target < 0 {
+		return fmt.Errorf("stage target concurrency of %d is negative", s.Target)
+	}
+	if s.Mode == "" {
+		s.Mode = "ramp"
+	}
+	if s.Mode != "ramp" && s.Mode != "step" {
+		return fmt.Errorf("unknown stage mode `%s`", s.Mode)
+	}
+	return nil
+}
+
+// Concurrency returns the concurrency to use after the elapsed time in this stage, starting from the given concurrency.
+func (s *Stage) Concurrency(from int, elapsed time.Duration) int {
+	if s.Mode == "step" || elapsed >= s.Duration.Duration {
+		return s.Target
+	}
+	progress := float64(elapsed) / float64(s.Duration.Duration)
+	return from + int(math.Floor(float64(s.Target-from)*progress+0.5))
+}
+
+func (s Stage) String() string {
+	return fmt.Sprintf("%s to %d over %s", s.Mode, s.Target, s.Duration.String())
+}
+
+// StageResult stores the result of the requests started during a given stage.
+type StageResult struct {
+	Mode      string         `xml:"mode,attr"`
+	Target    int            `xml:"target,attr"`
+	Duration  Duration       `xml:"duration,attr"`
+	Requests  int            `xml:"requests,attr"`
+	Times     *Percentages   `xml:"times"`
+	Statuses  []Status       `xml:"status"`
+	StatusSum *StatusSummary `xml:"statuses"`
+}
+
+// loadStages returns the stages of this request. A request with a duration has a single stage
+// during which the concurrency is held.
+func (r *Request) loadStages() []*Stage {
+	if r.Stages != nil {
+		return r.Stages
+	}
+	return []*Stage{{Duration: r.Duration, Target: r.Concurrency, Mode: "step"}}
+}
+
+// runStages sends requests with a concurrency which is adjusted live according to the stages.
+// The wait groups are incremented for each request sent, and the stage hold on doneWg is released
+// once all the stages are over and all the workers have returned.
+func (r *Request) runStages(greq goreq.Request, wg *sync.WaitGroup) {
+	var workersWg sync.WaitGroup
+	workers := []chan struct{}{}
+	concurrency := r.Concurrency
+	stageStart := time.Now()
+	for sno, stage := range r.loadStages() {
+		log.Notice("Starting stage #%d (%s) of %s.", sno+1, stage, r.URL)
+		atomic.StoreInt32(&r.stage, int32(sno))
+		stageEnd := stageStart.Add(stage.Duration.Duration)
+		for now := time.Now(); now.Before(stageEnd); now = time.Now() {
+			want := stage.Concurrency(concurrency, now.Sub(stageStart))
+			// Let's start new workers, or stop the latest ones, to match the wanted concurrency.
+			for len(workers) < want {
+				stop := make(chan struct{})
+				workers = append(workers, stop)
+				workersWg.Add(1)
+				go r.work(stop, greq, wg, &workersWg)
+			}
+			for len(workers) > want {
+				close(workers[len(workers)-1])
+				workers = workers[:len(workers)-1]
+			}
+			if remaining := stageEnd.Sub(now); remaining < stageTick {
+				time.Sleep(remaining)
+			} else {
+				time.Sleep(stageTick)
+			}
+		}
+		concurrency = stage.Target
+		stageStart = stageEnd
+	}
+	for _, stop := range workers {
+		close(stop)
+	}
+	workersWg.Wait()
+	r.doneWg.Done()
+}
+
+// work sends requests one after the other until it is told to stop.
+func (r *Request) work(stop chan struct{}, greq goreq.Request, wg *sync.WaitGroup, workersWg *sync.WaitGroup) {
+	defer workersWg.Done()
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+		no := atomic.AddInt64(&r.sent, 1)
+		wg.Add(1)
+		r.doneWg.Add(1)
+		r.doneChan <- r.do(int(no), greq, time.Time{}, r.URL.Generate())
+	}
+}
+
+// computeStageResults returns the result of each stage of this request.
+func (r *Request) computeStageResults() []*StageResult {
+	results := make([]*StageResult, len(r.Stages))
+	for sno, stage := range r.Stages {
+		agg := r.stageAggs[sno]
+		results[sno] = &StageResult{Mode: stage.Mode, Target: stage.Target, Duration: stage.Duration,
+			Requests: agg.count, Times: agg.times, Statuses: agg.Statuses(), StatusSum: agg.Summary()}
+		log.Notice("STAGE #%d SUMMARY (%s): %d request(s) %s", sno+1, stage, results[sno].Requests, results[sno].Times)
+	}
+	return results
+}
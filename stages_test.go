@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestStages(t *testing.T) {
+	Convey("Testing load stages", t, func() {
+		Convey("The concurrency of a stage should be correct", func() {
+			ramp := Stage{Duration: Duration{Duration: time.Second * 10}, Target: 200}
+			So(ramp.Validate(), ShouldBeNil)
+			So(ramp.Mode, ShouldEqual, "ramp")
+			So(ramp.Concurrency(0, 0), ShouldEqual, 0)
+			So(ramp.Concurrency(0, time.Second*5), ShouldEqual, 100)
+			So(ramp.Concurrency(100, time.Second*5), ShouldEqual, 150)
+			So(ramp.Concurrency(400, time.Second*5), ShouldEqual, 300)
+			So(ramp.Concurrency(0, time.Second*20), ShouldEqual, 200)
+			spike := Stage{Duration: Duration{Duration: time.Second * 30}, Target: 500, Mode: "step"}
+			So(spike.Validate(), ShouldBeNil)
+			So(spike.Concurrency(200, 0), ShouldEqual, 500)
+			So(spike.String(), ShouldEqual, "step to 500 over 30s")
+		})
+		Convey("Invalid stages should fail validation", func() {
+			for _, stage := range []Stage{
+				{Target: 1},
+				{Duration: Duration{Duration: time.Second}, Target: -1},
+				{Duration: Duration{Duration: time.Second}, Target: 1, Mode: "spike"},
+			} {
+				So(stage.Validate(), ShouldNotBeNil)
+			}
+		})
+		Convey("Stages cannot be combined with a rate", func() {
+			r := Request{Method: "get", Rate: Rate{Count: 1, Per: time.Second}, Stages: []*Stage{{Duration: Duration{Duration: time.Second}}}, URL: &URL{}}
+			So(r.Validate(), ShouldNotBeNil)
+		})
+		Convey("Stages are read from XML", func() {
+			out := StressTest{}
+			xml.Unmarshal([]byte(`<test><stages><stage duration="2m" target="200" /><stage duration="30s" target="500" mode="step" /></stages>
+				<request method="get"><url base="http://example.org/" /></request></test>`), &out)
+			So(len(out.Stages), ShouldEqual, 2)
+			So(out.Stages[0].Duration.Duration, ShouldEqual, time.Minute*2)
+			So(out.Stages[1].Target, ShouldEqual, 500)
+			So(out.Stages[1].Mode, ShouldEqual, "step")
+			// Top-level requests inherit the stages of the test.
+			p := Profile{Tests: []*StressTest{&out}}
+			So(p.Validate(), ShouldBeNil)
+			So(len(out.Requests[0].Stages), ShouldEqual, 2)
+		})
+		Convey("The concurrency is adjusted live", func() {
+			var inFlight, maxInFlight int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				current := atomic.AddInt32(&inFlight, 1)
+				for {
+					max := atomic.LoadInt32(&maxInFlight)
+					if current <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, current) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond * 20)
+				atomic.AddInt32(&inFlight, -1)
+				w.WriteHeader(204)
+			}))
+			defer ts.Close()
+			profile = &Profile{UserAgent: "StressGauge/0.x"}
+			r := Request{Method: "get", URL: &URL{Base: ts.URL}, Stages: []*Stage{
+				{Duration: Duration{Duration: time.Millisecond * 300}, Target: 2, Mode: "step"},
+				{Duration: Duration{Duration: time.Millisecond * 300}, Target: 8, Mode: "step"},
+				{Duration: Duration{Duration: time.Millisecond * 300}, Target: 0},
+			}}
+			r.Validate()
+			var wg sync.WaitGroup
+			r.Spawn(nil, &wg)
+			wg.Wait()
+			So(maxInFlight, ShouldBeBetweenOrEqual, 7, 8)
+			So(len(r.Result.Stages), ShouldEqual, 3)
+			total := 0
+			for _, stage := range r.Result.Stages {
+				total += stage.Requests
+				So(stage.StatusSum.S2xx, ShouldEqual, stage.Requests)
+			}
+			So(total, ShouldEqual, r.Result.Repetitions)
+			// The second stage has four times the concurrency of the first one.
+			So(r.Result.Stages[1].Requests, ShouldBeGreaterThan, r.Result.Stages[0].Requests*2)
+		})
+	})
+}
@@ -1,10 +1,15 @@
 package main
 
 import (
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
+
+	"github.com/HdrHistogram/hdrhistogram-go"
 )
 
 // Duration allows automatic unmarshaling of a duration from XML.
@@ -38,13 +43,49 @@ func (dur *Duration) String() string {
 	return dur.Duration.String()
 }
 
-// MarshalXMLAttr implements the xml.MarshalerAttr interface.
+// MarshalXMLAttr implements the xml.MarshalerAttr interface. Durations which are not set are omitted.
 func (dur *Duration) MarshalXMLAttr(name xml.Name) (attr xml.Attr, err error) {
+	if dur.IsZero() {
+		return
+	}
 	attr.Name = name
 	attr.Value = dur.String()
 	return
 }
 
+// IsZero returns whether the duration is not set, so that it is omitted from JSON and YAML profiles.
+func (dur Duration) IsZero() bool {
+	return dur.Duration == 0
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (dur Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(dur.Duration.String())
+}
+
+// UnmarshalJSON unmarshals a duration from a JSON string, e.g. "1m30s".
+func (dur *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	return dur.UnmarshalXMLAttr(xml.Attr{Value: value})
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (dur Duration) MarshalYAML() (interface{}, error) {
+	return dur.Duration.String(), nil
+}
+
+// UnmarshalYAML unmarshals a duration from a YAML string, e.g. 1m30s.
+func (dur *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	return dur.UnmarshalXMLAttr(xml.Attr{Value: value})
+}
+
 // MarshalXML is a custom marshaller for Duration.
 func (dur *Duration) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	start.Attr = []xml.Attr{xml.Attr{Name: xml.Name{Local: "duration"}, Value: dur.Duration.String()},
@@ -55,94 +96,281 @@ func (dur *Duration) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
 	return nil
 }
 
-// Percentages stores some Percentagess.
+// Rate allows automatic unmarshaling of a request rate from XML, e.g. "200/s" or "5/100ms".
+type Rate struct {
+	Count float64
+	Per   time.Duration
+}
+
+// IsSet returns whether this rate was defined.
+func (rate Rate) IsSet() bool {
+	return rate.Count > 0 && rate.Per > 0
+}
+
+// PerSecond returns the number of requests per second for this rate.
+func (rate Rate) PerSecond() float64 {
+	if !rate.IsSet() {
+		return 0
+	}
+	return rate.Count / rate.Per.Seconds()
+}
+
+// Interval returns the time between the start of two consecutive requests.
+func (rate Rate) Interval() time.Duration {
+	if !rate.IsSet() {
+		return 0
+	}
+	return time.Duration(float64(rate.Per) / rate.Count)
+}
+
+// UnmarshalXMLAttr unmarshals a rate.
+func (rate *Rate) UnmarshalXMLAttr(attr xml.Attr) (err error) {
+	parsed, err := ParseRate(attr.Value)
+	if err != nil {
+		return
+	}
+	*rate = parsed
+	return nil
+}
+
+// MarshalXMLAttr implements the xml.MarshalerAttr interface. Rates which are not set are omitted.
+func (rate Rate) MarshalXMLAttr(name xml.Name) (attr xml.Attr, err error) {
+	if rate.IsZero() {
+		return
+	}
+	attr.Name = name
+	attr.Value = rate.String()
+	return
+}
+
+// IsZero returns whether the rate is not set, so that it is omitted from JSON and YAML profiles.
+func (rate Rate) IsZero() bool {
+	return rate == Rate{}
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (rate Rate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(rate.String())
+}
+
+// UnmarshalJSON unmarshals a rate from a JSON string, e.g. "200/s".
+func (rate *Rate) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	return rate.UnmarshalXMLAttr(xml.Attr{Value: value})
+}
+
+// MarshalYAML implements the yaml.Marshaler interface.
+func (rate Rate) MarshalYAML() (interface{}, error) {
+	return rate.String(), nil
+}
+
+// UnmarshalYAML unmarshals a rate from a YAML string, e.g. 200/s.
+func (rate *Rate) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var value string
+	if err := unmarshal(&value); err != nil {
+		return err
+	}
+	return rate.UnmarshalXMLAttr(xml.Attr{Value: value})
+}
+
+func (rate Rate) String() string {
+	per := rate.Per.String()
+	switch rate.Per {
+	case time.Second:
+		per = "s"
+	case time.Minute:
+		per = "m"
+	case time.Hour:
+		per = "h"
+	}
+	return strconv.FormatFloat(rate.Count, 'f', -1, 64) + "/" + per
+}
+
+// ParseRate parses a rate such as "200/s", "12000/m" or "5/100ms". A rate without unit is per second.
+func ParseRate(s string) (rate Rate, err error) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) > 2 {
+		return rate, fmt.Errorf("invalid rate `%s`", s)
+	}
+	rate.Count, err = strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return rate, fmt.Errorf("invalid rate `%s`: %s", s, err)
+	}
+	rate.Per = time.Second
+	if len(parts) == 2 {
+		unit := strings.TrimSpace(parts[1])
+		if unit != "" && (unit[0] < '0' || unit[0] > '9') {
+			unit = "1" + unit
+		}
+		if rate.Per, err = time.ParseDuration(unit); err != nil {
+			return rate, fmt.Errorf("invalid rate `%s`: %s", s, err)
+		}
+	}
+	if rate.Count <= 0 || rate.Per <= 0 {
+		return rate, fmt.Errorf("rate `%s` must be positive", s)
+	}
+	return rate, nil
+}
+
+// significantFigures is the precision of the response time histograms, as set in the profile.
+var significantFigures = 3
+
+// reportedPercentiles are the percentiles reported in the results, as set in the profile.
+var reportedPercentiles = []float64{10, 25, 50, 66, 75, 80, 90, 95, 98, 99}
+
+// ParsePercentiles parses a comma separated list of percentiles, such as "50,90,99,99.9".
+func ParsePercentiles(s string) ([]float64, error) {
+	percentiles := []float64{}
+	for _, part := range strings.Split(s, ",") {
+		perc, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid percentile `%s`", part)
+		}
+		if perc <= 0 || perc >= 100 {
+			return nil, fmt.Errorf("percentile `%s` must be strictly between 0 and 100", part)
+		}
+		percentiles = append(percentiles, perc)
+	}
+	sort.Float64s(percentiles)
+	return percentiles, nil
+}
+
+// longestTrackable is the longest duration which can be recorded; longer ones are recorded as this one.
+const longestTrackable = time.Hour
+
+// Percentages stores response times in a high dynamic range histogram, with a microsecond resolution.
+// It uses a constant amount of memory regardless of the number of recorded values.
 type Percentages struct {
 	MeanValue Duration `xml:"mean"`
-	vals      []*Duration
-	length    int
+	hist      *hdrhistogram.Histogram
+	critical  time.Duration
+	warning   time.Duration
+	hasState  bool
 }
 
 // MarshalXML handles the serializing into XML of Percentages.
 func (p *Percentages) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "count"}, Value: strconv.Itoa(p.Len())})
 	e.EncodeToken(start)
-	p.MeanValue.MarshalXML(e, xml.StartElement{Name: xml.Name{Local: "mean"}})
-	var elName string
-	for _, perc := range []int{0, 10, 25, 50, 66, 75, 80, 90, 95, 98, 99, 100} {
-		if perc == 0 {
-			elName = "shortest"
-		} else if perc == 100 {
-			elName = "longest"
-		} else {
-			elName = fmt.Sprintf("p%d", perc)
-		}
-		p.Percentage(perc).MarshalXML(e, xml.StartElement{Name: xml.Name{Local: elName}})
+	mean := Duration{Duration: p.Mean()}
+	if p.hasState {
+		mean.SetState(p.critical, p.warning)
 	}
+	mean.MarshalXML(e, xml.StartElement{Name: xml.Name{Local: "mean"}})
+	// The standard deviation is not a response time, so it has no state.
+	stddev := Duration{Duration: p.StdDev()}
+	stddev.MarshalXML(e, xml.StartElement{Name: xml.Name{Local: "stddev"}})
+	p.Percentage(0).MarshalXML(e, xml.StartElement{Name: xml.Name{Local: "shortest"}})
+	for _, perc := range reportedPercentiles {
+		elName := "p" + strconv.FormatFloat(perc, 'f', -1, 64)
+		p.Quantile(perc).MarshalXML(e, xml.StartElement{Name: xml.Name{Local: elName}})
+	}
+	p.Percentage(100).MarshalXML(e, xml.StartElement{Name: xml.Name{Local: "longest"}})
 	e.EncodeToken(xml.EndElement{Name: start.Name})
 	return nil
 }
 
-// Len is for the Sorter interface.
+// Len returns the number of recorded values.
 func (p *Percentages) Len() int {
-	return p.length
+	if p.hist == nil {
+		return 0
+	}
+	return int(p.hist.TotalCount())
 }
 
-// Less is for the Sorter interface.
-func (p *Percentages) Less(i, j int) bool {
-	return p.vals[i].Duration < p.vals[j].Duration
+// Record adds a value to the histogram.
+func (p *Percentages) Record(v time.Duration) {
+	if v > longestTrackable {
+		v = longestTrackable
+	}
+	p.hist.RecordValue(int64(v / time.Microsecond))
 }
 
-// Swap is for the Sorter interface.
-func (p *Percentages) Swap(i, j int) {
-	p.vals[i], p.vals[j] = p.vals[j], p.vals[i]
+// Merge adds all the values recorded in the provided percentages to these ones.
+func (p *Percentages) Merge(o *Percentages) {
+	if o.hist != nil {
+		p.hist.Merge(o.hist)
+	}
+	p.MeanValue.Duration = 0 // The mean must be computed again.
 }
 
-// Percentage returns the items in position X.
+// Percentage returns the value below which v percent of the values fall.
 func (p *Percentages) Percentage(v int) *Duration {
-	if v < 0 || v > 100 {
-		panic(fmt.Errorf("incorrect value requested %d", v))
+	return p.Quantile(float64(v))
+}
+
+// Quantile returns the value below which q percent of the values fall, where q may be fractional, e.g. 99.9.
+// A quantile of 0 is the shortest value and a quantile of 100 is the longest one.
+func (p *Percentages) Quantile(q float64) *Duration {
+	if q < 0 || q > 100 {
+		panic(fmt.Errorf("incorrect value requested %v", q))
+	}
+	if p.Len() == 0 {
+		return &Duration{}
 	}
-	if v == 0 {
-		return p.vals[0]
+	var value int64
+	switch q {
+	case 0:
+		value = p.hist.Min()
+	case 100:
+		value = p.hist.Max()
+	default:
+		// Low quantiles of small histograms would otherwise be reported as zero.
+		if value = p.hist.ValueAtQuantile(q); value < p.hist.Min() {
+			value = p.hist.Min()
+		}
 	}
-	if v == 100 {
-		return p.vals[p.length-1]
+	dur := &Duration{Duration: time.Duration(value) * time.Microsecond}
+	if p.hasState {
+		dur.SetState(p.critical, p.warning)
 	}
-	return p.vals[int(float64(p.length)*float64(v)/100)]
+	return dur
 }
 
 // Mean returns the mean of this set of values.
 func (p *Percentages) Mean() time.Duration {
-	if p.MeanValue.Duration == 0 && p.length > 0 {
-		sum := int64(0)
-		for i := 0; i < p.length; i++ {
-			sum += p.vals[i].Duration.Nanoseconds()
-		}
-		p.MeanValue.Duration = time.Duration(sum / int64(p.length))
+	if p.MeanValue.Duration == 0 && p.Len() > 0 {
+		p.MeanValue.Duration = time.Duration(p.hist.Mean() * float64(time.Microsecond))
 	}
 	return p.MeanValue.Duration
 }
 
+// StdDev returns the standard deviation of this set of values.
+func (p *Percentages) StdDev() time.Duration {
+	if p.Len() == 0 {
+		return 0
+	}
+	return time.Duration(p.hist.StdDev() * float64(time.Microsecond))
+}
+
 // SetState sets the state of each percentile based on the input parameters.
 func (p *Percentages) SetState(critical time.Duration, warning time.Duration) {
-	for i := 0; i < p.length; i++ {
-		p.vals[i].SetState(critical, warning)
-	}
+	p.critical = critical
+	p.warning = warning
+	p.hasState = true
+	p.Mean()
 	p.MeanValue.SetState(critical, warning)
 }
 
-//String implements the Stringer interface.
+// String implements the Stringer interface.
 func (p *Percentages) String() string {
-	return fmt.Sprintf("Shortest: %s Median: %s Q3: %s P95: %s Longest: %s", p.Percentage(1).String(),
+	return fmt.Sprintf("Shortest: %s Median: %s Q3: %s P95: %s Longest: %s", p.Percentage(0).String(),
 		p.Percentage(50).String(), p.Percentage(75).String(), p.Percentage(95).String(), p.Percentage(100).String())
 }
 
-// NewPercentages returns a stuct which helps in serializing request results.
+// NewPercentages returns a stuct which helps in serializing request results, with the provided values already recorded.
 func NewPercentages(vals []time.Duration) *Percentages {
-	dVals := make([]*Duration, len(vals))
-	for i, v := range vals {
-		dVals[i] = &Duration{Duration: v}
+	p := newPercentages(significantFigures)
+	for _, v := range vals {
+		p.Record(v)
 	}
-	p := Percentages{vals: dVals, length: len(vals)}
-	sort.Sort(&p)
-	return &p
+	return p
+}
+
+// newPercentages returns empty percentages with the provided number of significant figures.
+func newPercentages(figures int) *Percentages {
+	return &Percentages{hist: hdrhistogram.New(1, int64(longestTrackable/time.Microsecond), figures)}
 }
@@ -10,34 +10,116 @@ import (
 
 func TestPercentages(t *testing.T) {
 	Convey("Testing percentages", t, func() {
-		Convey("Given a slice of floats, the percentages should be correct", func() {
+		Convey("Given a slice of durations, the percentages should be correct", func() {
+			defer func(percentiles []float64) { reportedPercentiles = percentiles }(reportedPercentiles)
+			reportedPercentiles = []float64{10, 25, 50, 66, 75, 80, 90, 95, 98, 99}
 			myslice := make([]time.Duration, 100)
 			for i := 0; i < 100; i++ {
 				myslice[99-i] = time.Microsecond * time.Duration(i)
 			}
 			p := NewPercentages(myslice)
-			for i := 0; i < 100; i++ {
-				So(p.Percentage(i).Duration, ShouldEqual, time.Microsecond*time.Duration(i))
+			So(p.Len(), ShouldEqual, 100)
+			So(p.Percentage(0).Duration, ShouldEqual, 0)
+			for i := 1; i < 100; i++ {
+				So(p.Percentage(i).Duration, ShouldEqual, time.Microsecond*time.Duration(i-1))
 			}
+			So(p.Percentage(100).Duration, ShouldEqual, time.Microsecond*99)
 			So(p.Mean(), ShouldEqual, time.Microsecond*time.Duration(49)+time.Nanosecond*500)
-			So(p.String(), ShouldEqual, `Shortest: 1µs Median: 50µs Q3: 75µs P95: 95µs Longest: 99µs`)
+			So(p.String(), ShouldEqual, `Shortest: 0s Median: 49µs Q3: 74µs P95: 94µs Longest: 99µs`)
 			p.SetState(time.Nanosecond, time.Second)
-			for i := 1; i < 100; i++ {
-				So(p.vals[i].State, ShouldEqual, "critical")
+			for i := 2; i <= 100; i++ {
+				So(p.Percentage(i).State, ShouldEqual, "critical")
 			}
 			p.SetState(time.Microsecond*time.Duration(75), time.Microsecond*time.Duration(50))
-			for i := 1; i < 50; i++ {
-				So(p.vals[i].State, ShouldEqual, "nominal")
+			for i := 0; i <= 50; i++ {
+				So(p.Percentage(i).State, ShouldEqual, "nominal")
 			}
-			for i := 50; i < 75; i++ {
-				So(p.vals[i].State, ShouldEqual, "warning")
+			for i := 51; i <= 75; i++ {
+				So(p.Percentage(i).State, ShouldEqual, "warning")
 			}
-			for i := 75; i < 100; i++ {
-				So(p.vals[i].State, ShouldEqual, "critical")
+			for i := 76; i <= 100; i++ {
+				So(p.Percentage(i).State, ShouldEqual, "critical")
 			}
 			b, _ := xml.Marshal(p)
-			So(string(b), ShouldEqual, `<Percentages><mean duration="49.5µs" state="nominal"></mean><shortest duration="0s" state="nominal"></shortest><p10 duration="10µs" state="nominal"></p10><p25 duration="25µs" state="nominal"></p25><p50 duration="50µs" state="warning"></p50><p66 duration="66µs" state="warning"></p66><p75 duration="75µs" state="critical"></p75><p80 duration="80µs" state="critical"></p80><p90 duration="90µs" state="critical"></p90><p95 duration="95µs" state="critical"></p95><p98 duration="98µs" state="critical"></p98><p99 duration="99µs" state="critical"></p99><longest duration="99µs" state="critical"></longest></Percentages>`)
+			So(string(b), ShouldEqual, `<Percentages count="100"><mean duration="49.5µs" state="nominal"></mean><stddev duration="28.866µs" state=""></stddev><shortest duration="0s" state="nominal"></shortest><p10 duration="9µs" state="nominal"></p10><p25 duration="24µs" state="nominal"></p25><p50 duration="49µs" state="nominal"></p50><p66 duration="65µs" state="warning"></p66><p75 duration="74µs" state="warning"></p75><p80 duration="79µs" state="critical"></p80><p90 duration="89µs" state="critical"></p90><p95 duration="94µs" state="critical"></p95><p98 duration="97µs" state="critical"></p98><p99 duration="98µs" state="critical"></p99><longest duration="99µs" state="critical"></longest></Percentages>`)
 			So(func() { p.Percentage(-1) }, ShouldPanic)
 		})
+		Convey("The reported percentiles can be configured, including fractional ones", func() {
+			defer func(percentiles []float64) { reportedPercentiles = percentiles }(reportedPercentiles)
+			vals := make([]time.Duration, 10000)
+			for i := range vals {
+				vals[i] = time.Microsecond * time.Duration(i+1)
+			}
+			p := NewPercentages(vals)
+			So(p.Quantile(99.9).Duration, ShouldBeBetweenOrEqual, time.Microsecond*9990, time.Microsecond*9995)
+			So(p.Quantile(99.99).Duration, ShouldBeBetweenOrEqual, time.Microsecond*9995, time.Microsecond*10005)
+			So(p.Mean(), ShouldBeBetweenOrEqual, time.Microsecond*4995, time.Microsecond*5010)
+			So(p.StdDev(), ShouldBeBetweenOrEqual, time.Microsecond*2880, time.Microsecond*2890)
+			var err error
+			reportedPercentiles, err = ParsePercentiles("99.9, 50")
+			So(err, ShouldBeNil)
+			So(reportedPercentiles, ShouldResemble, []float64{50, 99.9})
+			b, _ := xml.Marshal(p)
+			So(string(b), ShouldContainSubstring, `<Percentages count="10000">`)
+			So(string(b), ShouldContainSubstring, `<shortest duration="1µs" state=""></shortest><p50 duration="5.003ms" state=""></p50><p99.9 duration="9.991ms" state=""></p99.9><longest`)
+			for _, invalid := range []string{"", "50,a", "0", "100", "-1"} {
+				_, err = ParsePercentiles(invalid)
+				So(err, ShouldNotBeNil)
+			}
+		})
+		Convey("Recorded and merged durations should be kept with the configured precision", func() {
+			p := NewPercentages(nil)
+			So(p.Len(), ShouldEqual, 0)
+			So(p.Percentage(50).Duration, ShouldEqual, 0)
+			p.Record(time.Millisecond * 10)
+			p.Record(time.Millisecond * 20)
+			o := NewPercentages([]time.Duration{time.Second})
+			p.Merge(o)
+			So(p.Len(), ShouldEqual, 3)
+			So(p.Percentage(0).Duration, ShouldEqual, time.Millisecond*10)
+			So(p.Percentage(50).Duration, ShouldBeBetweenOrEqual, time.Millisecond*20, time.Millisecond*20+time.Microsecond*20)
+			// Three significant figures.
+			So(p.Percentage(100).Duration, ShouldBeBetweenOrEqual, time.Second, time.Second+time.Millisecond)
+			// Durations above the longest trackable one are clamped.
+			p.Record(time.Hour * 2)
+			So(p.Percentage(100).Duration, ShouldBeBetweenOrEqual, longestTrackable, longestTrackable+longestTrackable/1000)
+		})
+	})
+}
+
+func TestRate(t *testing.T) {
+	Convey("Testing rates", t, func() {
+		Convey("Valid rates should be parsed correctly", func() {
+			for str, expected := range map[string]Rate{
+				"200/s":   {Count: 200, Per: time.Second},
+				"200":     {Count: 200, Per: time.Second},
+				"12000/m": {Count: 12000, Per: time.Minute},
+				"5/100ms": {Count: 5, Per: time.Millisecond * 100},
+				"0.5/s":   {Count: 0.5, Per: time.Second},
+			} {
+				rate, err := ParseRate(str)
+				So(err, ShouldBeNil)
+				So(rate, ShouldResemble, expected)
+			}
+			rate, _ := ParseRate("12000/m")
+			So(rate.PerSecond(), ShouldEqual, 200)
+			So(rate.Interval(), ShouldEqual, time.Millisecond*5)
+			So(rate.String(), ShouldEqual, "12000/m")
+			rate, _ = ParseRate("5/100ms")
+			So(rate.String(), ShouldEqual, "5/100ms")
+		})
+		Convey("Invalid rates should not be parsed", func() {
+			for _, str := range []string{"", "fast", "200/s/s", "-5/s", "0/s", "200/fortnight"} {
+				_, err := ParseRate(str)
+				So(err, ShouldNotBeNil)
+			}
+		})
+		Convey("Rates can be unmarshaled from XML", func() {
+			out := Request{}
+			So(xml.Unmarshal([]byte(`<request rate="50/s" duration="2s" />`), &out), ShouldBeNil)
+			So(out.Rate.PerSecond(), ShouldEqual, 50)
+			So(out.Duration.Duration, ShouldEqual, time.Second*2)
+			So(xml.Unmarshal([]byte(`<request rate="50/fortnight" />`), &out), ShouldNotBeNil)
+		})
 	})
 }
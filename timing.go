@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/franela/goreq"
+)
+
+// init makes the default transport of goreq dial with the context of the requests: it dials without one
+// otherwise, so the DNS lookup and the connection would never be traced.
+func init() {
+	if transport, ok := goreq.DefaultTransport.(*http.Transport); ok {
+		transport.DialContext = goreq.DefaultDialer.DialContext
+	}
+}
+
+// Timing stores the duration of each phase of a request. The phases which did not happen,
+// e.g. DNS lookup and connection when reusing a connection, have a zero duration.
+type Timing struct {
+	dns          time.Duration // Duration of the DNS lookup.
+	connect      time.Duration // Duration of the TCP connection.
+	tls          time.Duration // Duration of the TLS handshake.
+	ttfb         time.Duration // Time between the request being written and the first response byte.
+	transfer     time.Duration // Time between the first response byte and the end of the body.
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	wrote        time.Time
+	firstByte    time.Time
+	finished     bool       // Set once the request finished, after which the callbacks are ignored.
+	mutex        sync.Mutex // Connection attempts to several addresses may happen concurrently.
+}
+
+// hook sets up the tracing of the request, and is meant to be used as the OnBeforeRequest of a goreq.Request.
+func (t *Timing) hook(greq *goreq.Request, httpreq *http.Request) {
+	*httpreq = *httpreq.WithContext(httptrace.WithClientTrace(httpreq.Context(), t.trace()))
+}
+
+// trace returns the client trace which records the phases.
+func (t *Timing) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.update(func() { t.dnsStart = time.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.update(func() { t.dns = time.Since(t.dnsStart) })
+		},
+		ConnectStart: func(network, addr string) {
+			t.update(func() {
+				if t.connectStart.IsZero() {
+					t.connectStart = time.Now()
+				}
+			})
+		},
+		ConnectDone: func(network, addr string, err error) {
+			t.update(func() {
+				if err == nil && t.connect == 0 {
+					t.connect = time.Since(t.connectStart)
+				}
+			})
+		},
+		TLSHandshakeStart: func() {
+			t.update(func() { t.tlsStart = time.Now() })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.update(func() { t.tls = time.Since(t.tlsStart) })
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			t.update(func() { t.wrote = time.Now() })
+		},
+		GotFirstResponseByte: func() {
+			t.update(func() {
+				t.firstByte = time.Now()
+				if !t.wrote.IsZero() {
+					t.ttfb = t.firstByte.Sub(t.wrote)
+				}
+			})
+		},
+	}
+}
+
+// update applies the change of a trace callback, unless the request already finished: callbacks may
+// still fire afterwards, e.g. when a connection dialed in the background completes, and would
+// otherwise charge the phases of another connection to this request.
+func (t *Timing) update(change func()) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if !t.finished {
+		change()
+	}
+}
+
+// finish records the end of the body download, and returns a snapshot of the phases of the request.
+func (t *Timing) finish() *phaseTimes {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if !t.firstByte.IsZero() {
+		t.transfer = time.Since(t.firstByte)
+	}
+	t.finished = true
+	return &phaseTimes{dns: t.dns, connect: t.connect, tls: t.tls, ttfb: t.ttfb, transfer: t.transfer}
+}
+
+// phaseTimes are the durations of the phases of a finished request.
+type phaseTimes struct {
+	dns, connect, tls, ttfb, transfer time.Duration
+}
+
+// Phases stores the response times of each phase of a group of requests. The percentages
+// of a phase only account for the requests during which that phase happened.
+type Phases struct {
+	DNS      *Percentages `xml:"dns"`
+	Connect  *Percentages `xml:"connect"`
+	TLS      *Percentages `xml:"tls"`
+	TTFB     *Percentages `xml:"ttfb"`
+	Transfer *Percentages `xml:"transfer"`
+}
+
+// newPhases returns empty phases.
+func newPhases() *Phases {
+	return &Phases{DNS: NewPercentages(nil), Connect: NewPercentages(nil), TLS: NewPercentages(nil),
+		TTFB: NewPercentages(nil), Transfer: NewPercentages(nil)}
+}
+
+// record adds the phases which happened during a request.
+func (p *Phases) record(t *phaseTimes) {
+	if t == nil {
+		return
+	}
+	if t.dns > 0 {
+		p.DNS.Record(t.dns)
+	}
+	if t.connect > 0 {
+		p.Connect.Record(t.connect)
+	}
+	if t.tls > 0 {
+		p.TLS.Record(t.tls)
+	}
+	if t.ttfb > 0 {
+		p.TTFB.Record(t.ttfb)
+	}
+	if t.transfer > 0 {
+		p.Transfer.Record(t.transfer)
+	}
+}
+
+// merge adds the phases recorded in the provided ones.
+func (p *Phases) merge(o *Phases) {
+	p.DNS.Merge(o.DNS)
+	p.Connect.Merge(o.Connect)
+	p.TLS.Merge(o.TLS)
+	p.TTFB.Merge(o.TTFB)
+	p.Transfer.Merge(o.Transfer)
+}
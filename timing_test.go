@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTiming(t *testing.T) {
+	Convey("Testing the timing breakdown", t, func() {
+		Convey("Phases which did not happen are ignored", func() {
+			phases := newPhases()
+			phases.record(&phaseTimes{connect: time.Millisecond, ttfb: time.Millisecond * 10, transfer: time.Millisecond})
+			phases.record(&phaseTimes{ttfb: time.Millisecond * 20, transfer: time.Millisecond})
+			phases.record(nil)
+			So(phases.DNS.Len(), ShouldEqual, 0)
+			So(phases.Connect.Len(), ShouldEqual, 1)
+			So(phases.TLS.Len(), ShouldEqual, 0)
+			So(phases.TTFB.Len(), ShouldEqual, 2)
+			So(phases.TTFB.Percentage(100).Duration, ShouldBeBetweenOrEqual, time.Millisecond*20, time.Millisecond*21)
+			So(phases.Transfer.Len(), ShouldEqual, 2)
+		})
+		Convey("Callbacks which fire after the request finished are ignored", func() {
+			timing := &Timing{}
+			trace := timing.trace()
+			trace.ConnectStart("tcp", "127.0.0.1:80")
+			phases := timing.finish()
+			trace.ConnectDone("tcp", "127.0.0.1:80", nil)
+			So(phases.connect, ShouldEqual, 0)
+			So(timing.connect, ShouldEqual, 0)
+		})
+		Convey("The phases of actual requests are recorded", func() {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(time.Millisecond * 20)
+				w.Write([]byte(`{"first": "part",`))
+				w.(http.Flusher).Flush()
+				time.Sleep(time.Millisecond * 20)
+				w.Write([]byte(`"second": "part"}`))
+			}))
+			defer ts.Close()
+			profile = &Profile{UserAgent: "StressGauge/0.x"}
+			// Using the host name to go through a DNS lookup.
+			r := Request{Method: "get", Repeat: 4, Concurrency: 2, URL: &URL{Base: strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)}}
+			r.Validate()
+			var wg sync.WaitGroup
+			r.Spawn(nil, &wg)
+			wg.Wait()
+			So(r.Result.StatusSum.S2xx, ShouldEqual, 4)
+			So(r.Result.Phases.DNS.Len(), ShouldBeGreaterThan, 0)
+			So(r.Result.Phases.Connect.Len(), ShouldBeBetweenOrEqual, 1, 4)
+			So(r.Result.Phases.TLS.Len(), ShouldEqual, 0)
+			So(r.Result.Phases.TTFB.Len(), ShouldEqual, 4)
+			So(r.Result.Phases.TTFB.Percentage(0).Duration, ShouldBeGreaterThanOrEqualTo, time.Millisecond*15)
+			So(r.Result.Phases.Transfer.Len(), ShouldEqual, 4)
+			So(r.Result.Phases.Transfer.Percentage(0).Duration, ShouldBeGreaterThanOrEqualTo, time.Millisecond*15)
+		})
+	})
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// ValidationError is a problem of a profile, located by the path of the offending element,
+// e.g. `test "Login" > request[2] > url > token "{id}"`, and by its line and column once loaded from a file.
+type ValidationError struct {
+	Path    string
+	Line    int // Zero if unknown.
+	Column  int // Zero if unknown, e.g. for XML syntax errors.
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	msg := e.Message
+	if e.Path != "" {
+		msg = e.Path + ": " + msg
+	}
+	if e.Column > 0 {
+		msg = fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, msg)
+	} else if e.Line > 0 {
+		msg = fmt.Sprintf("line %d: %s", e.Line, msg)
+	}
+	return msg
+}
+
+// ValidationErrors are all the problems found when validating a profile or one of its elements.
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	lines := make([]string, len(errs))
+	for i, e := range errs {
+		lines[i] = e.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// add appends the problem of the element at the provided path, if any. Problems of nested
+// elements are prefixed with this path.
+func (errs *ValidationErrors) add(path string, err error) {
+	if err == nil {
+		return
+	}
+	if nested, ok := err.(ValidationErrors); ok {
+		for _, e := range nested {
+			*errs = append(*errs, &ValidationError{Path: joinPath(path, e.Path), Line: e.Line, Column: e.Column, Message: e.Message})
+		}
+		return
+	}
+	*errs = append(*errs, &ValidationError{Path: path, Message: err.Error()})
+}
+
+// orNil returns nil if there is no problem, so that validators do not return a non-nil empty error.
+func (errs ValidationErrors) orNil() error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// indexedElements are the elements which may be repeated, and are therefore located by their index.
+var indexedElements = map[string]bool{"test": true, "request": true, "stage": true, "slo": true, "token": true,
+	"header": true, "body": true, "json": true, "var": true, "include": true, "template": true}
+
+// labelAttributes are the attributes by which elements are located rather than by their index.
+var labelAttributes = map[string]string{"test": "name", "token": "token", "var": "name", "include": "file", "template": "name"}
+
+// elementPath returns the path of an element within its parent: by label if any (the name of
+// tests and tokens), by its index among its siblings of the same name if it may be repeated,
+// or else by its name alone.
+func elementPath(parent, name string, index int, label string) string {
+	segment := name
+	if label != "" {
+		segment = fmt.Sprintf("%s %q", name, label)
+	} else if indexedElements[name] {
+		segment = fmt.Sprintf("%s[%d]", name, index)
+	}
+	return joinPath(parent, segment)
+}
+
+// joinPath appends a path to that of its parent.
+func joinPath(parent, path string) string {
+	if parent == "" {
+		return path
+	}
+	if path == "" {
+		return parent
+	}
+	return parent + " > " + path
+}
+
+// position is the line and column of an element in a file.
+type position struct {
+	line, column int
+}
+
+// elementPositions returns the position of each element of a profile by its path, the root element being at "".
+func elementPositions(data []byte) map[string]position {
+	positions := map[string]position{}
+	type open struct {
+		path     string
+		siblings map[string]int
+	}
+	stack := []*open{}
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		offset := d.InputOffset()
+		token, err := d.Token()
+		if err != nil {
+			return positions // Syntax errors are reported by the XML decoding.
+		}
+		switch el := token.(type) {
+		case xml.StartElement:
+			path := ""
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.siblings[el.Name.Local]++
+				label := ""
+				for _, attr := range el.Attr {
+					if attr.Name.Local == labelAttributes[el.Name.Local] {
+						label = attr.Value
+					}
+				}
+				path = elementPath(parent.path, el.Name.Local, parent.siblings[el.Name.Local], label)
+			}
+			if _, exists := positions[path]; !exists {
+				line, column := offsetPosition(data, int(offset))
+				positions[path] = position{line, column}
+			}
+			stack = append(stack, &open{path: path, siblings: map[string]int{}})
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+// offsetPosition returns the line and column of the provided byte offset in the data.
+func offsetPosition(data []byte, offset int) (line, column int) {
+	line = bytes.Count(data[:offset], []byte("\n")) + 1
+	column = utf8.RuneCount(data[bytes.LastIndexByte(data[:offset], '\n')+1:offset]) + 1
+	return
+}
+
+// locate sets the line and column of each problem to those of its element in the provided profile data,
+// or to those of its closest located parent.
+func (errs ValidationErrors) locate(data []byte) {
+	positions := elementPositions(data)
+	for _, e := range errs {
+		path := e.Path
+		for {
+			if pos, exists := positions[path]; exists {
+				e.Line, e.Column = pos.line, pos.column
+				break
+			}
+			if path == "" {
+				break
+			}
+			if i := strings.LastIndex(path, " > "); i >= 0 {
+				path = path[:i]
+			} else {
+				path = ""
+			}
+		}
+	}
+}
+
+// readProfile reads and validates a profile file, in XML, JSON or YAML depending on its extension,
+// once its variables are resolved and its fragments included. The problems of the profile are returned
+// as ValidationErrors along with the profile itself. Problems of XML profiles are located in the file.
+func readProfile(profileFile string) (*Profile, error) {
+	if profileFile == "" {
+		return nil, errors.New("profile filename is empty")
+	}
+	p, profileData, err := readProfileFile(profileFile, nil, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	if err = p.Validate(); err != nil {
+		if errs, ok := err.(ValidationErrors); ok && profileFormat(profileFile) == "xml" {
+			errs.locate(profileData)
+		}
+		return p, err
+	}
+	return p, nil
+}
+
+// validateCommand implements `sg validate profile.xml...`, which reports all the problems of each
+// profile. It returns the exit code: 0 if all are valid, 1 if any is invalid and 2 if any cannot be read.
+func validateCommand(args []string, out io.Writer) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(out, "usage: sg validate profile.xml...")
+		return 2
+	}
+	code := 0
+	for _, filename := range args {
+		_, err := readProfile(filename)
+		errs, invalid := err.(ValidationErrors)
+		switch {
+		case err == nil:
+			fmt.Fprintf(out, "%s is valid.\n", filename)
+		case invalid:
+			for _, e := range errs {
+				location := filename
+				if e.Column > 0 {
+					location = fmt.Sprintf("%s:%d:%d", filename, e.Line, e.Column)
+				} else if e.Line > 0 {
+					location = fmt.Sprintf("%s:%d", filename, e.Line)
+				}
+				if e.Path != "" {
+					fmt.Fprintf(out, "%s: %s: %s\n", location, e.Path, e.Message)
+				} else {
+					fmt.Fprintf(out, "%s: %s\n", location, e.Message)
+				}
+			}
+			fmt.Fprintf(out, "%d problem(s) in %s.\n", len(errs), filename)
+			if code == 0 {
+				code = 1
+			}
+		default:
+			fmt.Fprintf(out, "could not read %s: %s\n", filename, err)
+			code = 2
+		}
+	}
+	return code
+}
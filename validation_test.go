@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidation(t *testing.T) {
+	Convey("Testing the validation of profiles", t, func() {
+		defer func(figures int, percentiles []float64) {
+			significantFigures, reportedPercentiles = figures, percentiles
+		}(significantFigures, reportedPercentiles)
+		dir, _ := ioutil.TempDir("", "sg")
+		defer os.RemoveAll(dir)
+		invalid := filepath.Join(dir, "invalid.xml")
+		ioutil.WriteFile(invalid, []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<sg name="Invalid" uid="1" precision="9">
+	<test name="Login" critical="1s" warning="750ms">
+		<slo>p95 &lt; soon</slo>
+		<request method="post" repeat="1" concurrency="1">
+			<url base="http://example.org/login" />
+			<request repeat="1" concurrency="1">
+				<url base="http://example.org/items/{id}">
+					<token token="{id}" pattern="hex" />
+				</url>
+			</request>
+		</request>
+		<request method="get" repeat="1" concurrency="2">
+			<url base="http://example.org/" />
+			<assert status="200">
+				<body regex="(" />
+			</assert>
+		</request>
+	</test>
+	<test name="Empty" />
+</sg>`), 0644)
+
+		Convey("All the problems are reported at once, located by line, column and path", func() {
+			_, err := readProfile(invalid)
+			errs, ok := err.(ValidationErrors)
+			So(ok, ShouldBeTrue)
+			So(len(errs), ShouldEqual, 7)
+			So(*errs[0], ShouldResemble, ValidationError{Line: 2, Column: 1, Message: "precision must be between 1 and 5"})
+			So(*errs[1], ShouldResemble, ValidationError{Path: `test "Login" > slo[1]`, Line: 4, Column: 3,
+				Message: "invalid threshold in SLO `p95 < soon`: time: invalid duration \"soon\""})
+			So(errs[2].Path, ShouldEqual, `test "Login" > request[1] > request[1]`)
+			So(errs[2].Message, ShouldEqual, "method not defined")
+			So(errs[2].Line, ShouldEqual, 7)
+			So(errs[3].Path, ShouldEqual, `test "Login" > request[1] > request[1] > url > token "{id}"`)
+			So(errs[3].Message, ShouldEqual, "unknown pattern hex in URL Token")
+			So(errs[3].Line, ShouldEqual, 9)
+			So(errs[3].Column, ShouldEqual, 6)
+			So(errs[4].Path, ShouldEqual, `test "Login" > request[2]`)
+			So(errs[4].Line, ShouldEqual, 13)
+			So(errs[5].Path, ShouldEqual, `test "Login" > request[2] > assert > body[1]`)
+			So(errs[5].Line, ShouldEqual, 16)
+			So(errs[6].Error(), ShouldEqual, `line 20, column 2: test "Empty": there are no requests to send`)
+
+			Convey("and loading the profile fails with all of them", func() {
+				err := loadProfile(invalid)
+				So(err, ShouldNotBeNil)
+				So(strings.Count(err.Error(), "\n"), ShouldEqual, 8)
+			})
+		})
+
+		Convey("sg validate lists the problems of each profile", func() {
+			out := &bytes.Buffer{}
+			So(validateCommand([]string{"docs/examples/basic.xml"}, out), ShouldEqual, 0)
+			So(out.String(), ShouldEqual, "docs/examples/basic.xml is valid.\n")
+			out.Reset()
+			So(validateCommand([]string{"docs/examples/basic.xml", invalid}, out), ShouldEqual, 1)
+			So(out.String(), ShouldContainSubstring, invalid+`:9:6: test "Login" > request[1] > request[1] > url > token "{id}": unknown pattern hex`)
+			So(out.String(), ShouldEndWith, "7 problem(s) in "+invalid+".\n")
+		})
+
+		Convey("XML syntax errors are located by line", func() {
+			broken := filepath.Join(dir, "broken.xml")
+			ioutil.WriteFile(broken, []byte("<sg>\n\t<test name=\"Broken\">\n</sg>"), 0644)
+			out := &bytes.Buffer{}
+			So(validateCommand([]string{broken}, out), ShouldEqual, 1)
+			So(out.String(), ShouldStartWith, broken+":3: ")
+		})
+
+		Convey("Profiles which cannot be read fail", func() {
+			out := &bytes.Buffer{}
+			So(validateCommand([]string{filepath.Join(dir, "missing.xml")}, out), ShouldEqual, 2)
+			So(validateCommand([]string{}, out), ShouldEqual, 2)
+			So(out.String(), ShouldContainSubstring, "usage: sg validate")
+		})
+
+		Convey("Paths are prefixed by those of the parent elements", func() {
+			errs := ValidationErrors{}
+			errs.add("test \"A\"", nil)
+			So(errs.orNil(), ShouldBeNil)
+			errs.add(elementPath("", "test", 2, ""), ValidationErrors{{Path: "request[1]", Message: "nested"}, {Message: "own"}})
+			So(errs[0].Path, ShouldEqual, "test[2] > request[1]")
+			So(errs[1].Path, ShouldEqual, "test[2]")
+			So(elementPath("request[1]", "url", 1, ""), ShouldEqual, "request[1] > url")
+		})
+	})
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// variableName matches the valid names of variables.
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// variableReference matches the references to variables in a profile, e.g. ${HOST}, or $${HOST} to write ${HOST} as is.
+var variableReference = regexp.MustCompile(`\$(\$?)\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// variableOverrides stores the values of the variables set with -var, which take precedence over the environment.
+var variableOverrides = variableFlags{}
+
+// Variable is a variable of a profile, which is referenced as ${NAME} anywhere in the profile,
+// e.g. in URLs, headers, data or numeric attributes.
+type Variable struct {
+	Name    string `xml:"name,attr" json:"name" yaml:"name"`
+	Default string `xml:"default,attr,omitempty" json:"default,omitempty" yaml:"default,omitempty"` // Value used if neither -var nor the environment set it.
+}
+
+// Variables are the variables of a profile, whose <variables> element is omitted from XML if there are none.
+type Variables []*Variable
+
+// MarshalXML implements the xml.Marshaler interface.
+func (v Variables) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(struct {
+		Variables []*Variable `xml:"var"`
+	}{v}, start)
+}
+
+// UnmarshalXML implements the xml.Unmarshaler interface.
+func (v *Variables) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	wrapper := struct {
+		Variables []*Variable `xml:"var"`
+	}{}
+	err := d.DecodeElement(&wrapper, &start)
+	*v = append(*v, wrapper.Variables...)
+	return err
+}
+
+// Validate confirms that a variable has a valid name.
+func (v *Variable) Validate() error {
+	if !variableName.MatchString(v.Name) {
+		return fmt.Errorf("invalid variable name `%s`", v.Name)
+	}
+	return nil
+}
+
+// variableFlags are the repeatable -var name=value flags.
+type variableFlags map[string]string
+
+func (v variableFlags) String() string {
+	pairs := []string{}
+	for name, value := range v {
+		pairs = append(pairs, name+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set parses a name=value flag.
+func (v variableFlags) Set(flag string) error {
+	i := strings.Index(flag, "=")
+	if i <= 0 {
+		return fmt.Errorf("expected name=value, got `%s`", flag)
+	}
+	v[flag[:i]] = flag[i+1:]
+	return nil
+}
+
+// value returns the value of the variable: that set with -var, or else that of the environment variable of the same
+// name, or else its default. It returns false if none is set.
+func (v *Variable) value(overrides map[string]string) (string, bool) {
+	if value, ok := overrides[v.Name]; ok {
+		return value, true
+	}
+	if value, ok := os.LookupEnv(v.Name); ok {
+		return value, true
+	}
+	return v.Default, v.Default != ""
+}
+
+// declaredVariables returns the variables declared in the profile data, without decoding the rest of the profile.
+func declaredVariables(data []byte, format string) ([]*Variable, error) {
+	// References may not be valid values yet, e.g. unquoted numbers in JSON, so they are replaced by one.
+	data = variableReference.ReplaceAll(data, []byte("0"))
+	declarations := struct {
+		Variables []*Variable `xml:"variables>var" json:"variables" yaml:"variables"`
+	}{}
+	var err error
+	switch format {
+	case "json":
+		err = json.Unmarshal(data, &declarations)
+	case "yaml":
+		err = yaml.Unmarshal(data, &declarations)
+	default:
+		err = xml.Unmarshal(data, &declarations)
+	}
+	return declarations.Variables, err
+}
+
+// resolveVariables replaces the references to variables in the profile data by their value: that inherited from
+// the including profile if any, or else that set with -var, or else that of the environment variable of the same
+// name, or else the default of the variable. Values are escaped for XML, for JSON strings and for their YAML
+// scalar, see yamlValue. It returns the resolved data along with the values of the variables. All the references which cannot be resolved are returned
+// as ValidationErrors located in the data.
+func resolveVariables(data []byte, format string, overrides, inherited map[string]string) ([]byte, map[string]string, error) {
+	declared := map[string]bool{}
+	values := map[string]string{}
+	for name, value := range inherited {
+		declared[name] = true
+		values[name] = value
+	}
+	variables, err := declaredVariables(data, format)
+	if err != nil {
+		return data, values, nil // Syntax errors are reported by the decoding of the profile.
+	}
+	for _, v := range variables {
+		if declared[v.Name] {
+			continue
+		}
+		declared[v.Name] = true
+		if value, ok := v.value(overrides); ok {
+			values[v.Name] = value
+		}
+	}
+	for name := range overrides {
+		if inherited == nil && !declared[name] {
+			log.Warning("variable %s is set with -var but not declared in the profile", name)
+		}
+	}
+
+	errs := ValidationErrors{}
+	resolved := &bytes.Buffer{}
+	last := 0
+	for _, match := range variableReference.FindAllSubmatchIndex(data, -1) {
+		resolved.Write(data[last:match[0]])
+		last = match[1]
+		name := string(data[match[4]:match[5]])
+		if match[3] > match[2] {
+			resolved.WriteString("${" + name + "}") // Escaped reference.
+			continue
+		}
+		e := &ValidationError{}
+		e.Line, e.Column = offsetPosition(data, match[0])
+		value, ok := values[name]
+		if !ok {
+			e.Message = fmt.Sprintf("variable %s is not set", name)
+			if !declared[name] {
+				e.Message = fmt.Sprintf("variable %s is not declared", name)
+			}
+			errs = append(errs, e)
+			continue
+		}
+		switch format {
+		case "json":
+			quoted, _ := json.Marshal(value)
+			resolved.Write(quoted[1 : len(quoted)-1])
+		case "yaml":
+			written, ok := yamlValue(data, match[0], match[1], value)
+			if !ok {
+				e.Message = fmt.Sprintf("value of variable %s cannot be written in this YAML scalar, which should be quoted", name)
+				errs = append(errs, e)
+				continue
+			}
+			resolved.WriteString(written)
+		default:
+			xml.EscapeText(resolved, []byte(value))
+		}
+	}
+	resolved.Write(data[last:])
+	return resolved.Bytes(), values, errs.orNil()
+}
+
+// markVariables replaces the references to variables in the profile data by unique markers, so that the profile is
+// decoded and encoded in another format, and restoreVariables then writes the references back instead of values
+// which may be secrets. Markers decode like the value of their variable, if any: a number, a duration, a rate, or
+// else a word. Booleans cannot be told apart, so they are resolved. Escaped references are marked too. It returns the
+// marked data along with the reference of each marker. The references to variables which are not declared are
+// returned as ValidationErrors located in the data.
+func markVariables(data []byte, format string, overrides map[string]string) ([]byte, map[string]string, error) {
+	variables, err := declaredVariables(data, format)
+	if err != nil {
+		return data, nil, nil // Syntax errors are reported by the decoding of the profile.
+	}
+	declared := map[string]*Variable{}
+	for _, v := range variables {
+		if declared[v.Name] == nil {
+			declared[v.Name] = v
+		}
+	}
+	errs := ValidationErrors{}
+	markers, references := map[string]string{}, map[string]string{}
+	marked := &bytes.Buffer{}
+	last, n := 0, 0
+	for _, match := range variableReference.FindAllSubmatchIndex(data, -1) {
+		marked.Write(data[last:match[0]])
+		last = match[1]
+		reference, name := string(data[match[0]:match[1]]), string(data[match[4]:match[5]])
+		value := ""
+		if match[3] == match[2] {
+			v := declared[name]
+			if v == nil {
+				e := &ValidationError{Message: fmt.Sprintf("variable %s is not declared", name)}
+				e.Line, e.Column = offsetPosition(data, match[0])
+				errs = append(errs, e)
+				continue
+			}
+			value, _ = v.value(overrides)
+		}
+		if value == "true" || value == "false" {
+			marked.WriteString(value)
+			continue
+		}
+		marker, exists := markers[reference]
+		for !exists && (marker == "" || references[marker] != "" || bytes.Contains(data, []byte(marker))) {
+			marker = variableMarker(value, n)
+			n++
+		}
+		markers[reference], references[marker] = marker, reference
+		marked.WriteString(marker)
+	}
+	marked.Write(data[last:])
+	return marked.Bytes(), references, errs.orNil()
+}
+
+// variableMarker returns the nth marker of markVariables, which decodes like the value.
+func variableMarker(value string, n int) string {
+	if _, err := strconv.Atoi(value); err == nil {
+		return strconv.Itoa(1000000000 + n)
+	}
+	if _, err := time.ParseDuration(value); err == nil {
+		return (time.Hour*1000 + time.Duration(n)*time.Millisecond).String()
+	}
+	if _, err := ParseRate(value); err == nil {
+		return Rate{Count: float64(1000000 + n), Per: time.Second}.String()
+	}
+	return fmt.Sprintf("SGVARIABLE%dX", n)
+}
+
+// restoreVariables writes back the references which markVariables replaced by markers in the encoded profile.
+func restoreVariables(content []byte, references map[string]string) []byte {
+	for marker, reference := range references {
+		content = bytes.Replace(content, []byte(marker), []byte(reference), -1)
+	}
+	return content
+}
+
+// yamlValue returns the value of a variable as written at the reference between start and end of the YAML data:
+// escaped as in JSON strings within a double-quoted scalar, with doubled quotes within a single-quoted one, and as
+// is in a plain scalar if it reads the same, e.g. a number or a URL. Otherwise, it is written as a double-quoted
+// scalar if the reference is the whole scalar, and it returns false if it is not. The context of the reference
+// is only read from its line.
+func yamlValue(data []byte, start, end int, value string) (string, bool) {
+	lineStart := bytes.LastIndexByte(data[:start], '\n') + 1
+	lineEnd := bytes.IndexByte(data[end:], '\n')
+	if lineEnd < 0 {
+		lineEnd = len(data)
+	} else {
+		lineEnd += end
+	}
+	quote, scalarStart, flow := byte(0), true, 0
+	for i := lineStart; i < start; i++ {
+		c, next := data[i], data[i+1]
+		switch {
+		case quote == '"':
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				quote = 0
+			}
+		case quote == '\'':
+			if c == '\'' && next == '\'' {
+				i++
+			} else if c == '\'' {
+				quote = 0
+			}
+		case c == ' ' || c == '\t':
+		case scalarStart && (c == '"' || c == '\''):
+			quote, scalarStart = c, false
+		case scalarStart && (c == '[' || c == '{'):
+			flow++
+		case flow > 0 && c == ',':
+			scalarStart = true
+		case flow > 0 && (c == ']' || c == '}'):
+			flow--
+		case (c == ':' || scalarStart && c == '-') && (next == ' ' || next == '\t'):
+			scalarStart = true
+		default:
+			scalarStart = false
+		}
+	}
+	switch quote {
+	case '"':
+		quoted, _ := json.Marshal(value)
+		return string(quoted[1 : len(quoted)-1]), true
+	case '\'':
+		return strings.Replace(value, "'", "''", -1), !strings.ContainsAny(value, "\r\n")
+	}
+	if yamlPlain(value, scalarStart, flow > 0) {
+		return value, true
+	}
+	rest := string(data[end:lineEnd])
+	trimmed := strings.TrimLeft(rest, " \t\r")
+	if scalarStart && (trimmed == "" || trimmed[0] == '#' && trimmed != rest || flow > 0 && strings.IndexByte(",]}", trimmed[0]) >= 0) {
+		quoted, _ := json.Marshal(value)
+		return string(quoted), true
+	}
+	return "", false
+}
+
+// yamlPlain returns whether a value reads the same when written as is in a plain YAML scalar, at its start or not,
+// and within a flow collection or not.
+func yamlPlain(value string, atStart, flow bool) bool {
+	if value == "" {
+		return true
+	}
+	if strings.ContainsAny(value, "\t\r\n") || strings.Contains(value, ": ") || strings.Contains(value, " #") ||
+		strings.HasSuffix(value, ":") || strings.TrimSpace(value) != value {
+		return false
+	}
+	if flow && strings.ContainsAny(value, ",[]{}") {
+		return false
+	}
+	if !atStart {
+		return true
+	}
+	if value == "~" || strings.EqualFold(value, "null") {
+		return false
+	}
+	if strings.IndexByte("-?:", value[0]) >= 0 {
+		return len(value) > 1 && value[1] != ' '
+	}
+	return strings.IndexByte(",[]{}#&*!|>'\"%@`", value[0]) < 0
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestVariables(t *testing.T) {
+	Convey("Testing the variables of profiles", t, func() {
+		defer func(overrides variableFlags) { variableOverrides = overrides }(variableOverrides)
+		defer func(figures int, percentiles []float64) {
+			significantFigures, reportedPercentiles = figures, percentiles
+		}(significantFigures, reportedPercentiles)
+		defer os.Unsetenv("SG_TEST_HOST")
+		os.Unsetenv("SG_TEST_HOST")
+		variableOverrides = variableFlags{}
+		dir, _ := ioutil.TempDir("", "sg")
+		defer os.RemoveAll(dir)
+		xmlFile := filepath.Join(dir, "profile.xml")
+		ioutil.WriteFile(xmlFile, []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<sg name="Variables" uid="vars-1">
+	<variables>
+		<var name="SG_TEST_HOST" default="http://localhost:8080" />
+		<var name="USERS" default="2" />
+		<var name="PASSWORD" />
+		<var name="USER_NAME" default="a&amp;b" />
+	</variables>
+	<test name="Login" critical="1s" warning="750ms">
+		<request method="post" repeat="10" concurrency="${USERS}">
+			<url base="${SG_TEST_HOST}/login?user=${USER_NAME}" />
+			<data>{"password": "${PASSWORD}", "literal": "$${USERS}"}</data>
+		</request>
+	</test>
+</sg>`), 0644)
+
+		Convey("Values are set by -var, then by the environment, then by default", func() {
+			variableOverrides.Set("PASSWORD=s3cr3t")
+			p, err := readProfile(xmlFile)
+			So(err, ShouldBeNil)
+			request := p.Tests[0].Requests[0]
+			So(request.Concurrency, ShouldEqual, 2)
+			So(request.URL.Base, ShouldEqual, "http://localhost:8080/login?user=a&b")
+			So(request.Data.Data, ShouldEqual, `{"password": "s3cr3t", "literal": "${USERS}"}`)
+			So(len(p.Variables), ShouldEqual, 4)
+
+			os.Setenv("SG_TEST_HOST", "https://staging.example.org")
+			variableOverrides.Set("USERS=5")
+			p, err = readProfile(xmlFile)
+			So(err, ShouldBeNil)
+			So(p.Tests[0].Requests[0].Concurrency, ShouldEqual, 5)
+			So(p.Tests[0].Requests[0].URL.Base, ShouldEqual, "https://staging.example.org/login?user=a&b")
+
+			variableOverrides.Set("SG_TEST_HOST=https://example.org")
+			p, _ = readProfile(xmlFile)
+			So(p.Tests[0].Requests[0].URL.Base, ShouldEqual, "https://example.org/login?user=a&b")
+		})
+
+		Convey("Variables which are not set or not declared are located", func() {
+			_, err := readProfile(xmlFile)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "line 12, column 24: variable PASSWORD is not set")
+
+			_, _, err = resolveVariables([]byte("<sg>\n\t<test name=\"${TEST}\" />\n</sg>"), "xml", nil, nil)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "line 2, column 14: variable TEST is not declared")
+		})
+
+		Convey("Values are escaped for JSON strings, and may stand for numbers", func() {
+			data := []byte(`{"variables": [{"name": "USERS", "default": "3"}, {"name": "QUOTE", "default": "say \"hi\""}],
+	"name": "${QUOTE}", "tests": [{"name": "T", "requests": [{"method": "get", "repeat": 1, "concurrency": ${USERS},
+	"url": {"base": "http://example.org/"}}]}]}`)
+			resolved, values, err := resolveVariables(data, "json", nil, nil)
+			So(err, ShouldBeNil)
+			So(values, ShouldResemble, map[string]string{"USERS": "3", "QUOTE": `say "hi"`})
+			p, err := decodeProfile(resolved, "json")
+			So(err, ShouldBeNil)
+			So(p.Name, ShouldEqual, `say "hi"`)
+			So(p.Tests[0].Requests[0].Concurrency, ShouldEqual, 3)
+		})
+
+		Convey("Values are escaped for their YAML scalar, or located if they cannot be", func() {
+			data := []byte(`variables:
+- name: USERS
+  default: "3"
+- name: QUOTE
+  default: say "hi"
+- name: LINES
+  default: "a\nb: c"
+name: ${LINES}
+tests:
+- name: "${QUOTE}"
+  requests:
+  - {method: get, repeat: 1, concurrency: ${USERS}, url: {base: "http://example.org/"}, data: {data: 'it''s ${QUOTE}'}}
+`)
+			resolved, _, err := resolveVariables(data, "yaml", nil, nil)
+			So(err, ShouldBeNil)
+			p, err := decodeProfile(resolved, "yaml")
+			So(err, ShouldBeNil)
+			So(p.Name, ShouldEqual, "a\nb: c")
+			So(p.Tests[0].Name, ShouldEqual, `say "hi"`)
+			So(p.Tests[0].Requests[0].Concurrency, ShouldEqual, 3)
+			So(p.Tests[0].Requests[0].Data.Data, ShouldEqual, `it's say "hi"`)
+
+			_, _, err = resolveVariables([]byte("variables:\n- name: LINES\n  default: \"a\\nb\"\nname: x ${LINES}\n"), "yaml", nil, nil)
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "line 4, column 9: value of variable LINES cannot be written in this YAML scalar, which should be quoted")
+		})
+
+		Convey("Variable names must be valid and unique", func() {
+			p := &Profile{Variables: []*Variable{{Name: "HOST"}, {Name: "2FA"}, {Name: "HOST"}},
+				Tests: []*StressTest{{Name: "T", Requests: []*Request{{Method: "GET", Repeat: 1, Concurrency: 1, URL: &URL{Base: "http://example.org/"}}}}}}
+			err := p.Validate()
+			So(err, ShouldNotBeNil)
+			So(err.Error(), ShouldEqual, "variables > var \"2FA\": invalid variable name `2FA`\nvariables > var \"HOST\": variable HOST is declared twice")
+		})
+
+		Convey("The -var flag expects name=value pairs", func() {
+			flags := variableFlags{}
+			So(flags.Set("HOST=http://a=b"), ShouldBeNil)
+			So(flags["HOST"], ShouldEqual, "http://a=b")
+			So(flags.Set("=value"), ShouldNotBeNil)
+			So(flags.Set("HOST"), ShouldNotBeNil)
+			flags.Set("A=1")
+			So(flags.String(), ShouldEqual, "A=1,HOST=http://a=b")
+		})
+
+		Convey("sg convert keeps the references to the variables", func() {
+			variableOverrides.Set("PASSWORD=secret")
+			yamlFile, jsonFile := filepath.Join(dir, "profile.yaml"), filepath.Join(dir, "profile.json")
+			So(convertCommand([]string{xmlFile, yamlFile}, &bytes.Buffer{}), ShouldEqual, 0)
+			content, _ := ioutil.ReadFile(yamlFile)
+			So(string(content), ShouldContainSubstring, "- name: USERS\n  default: \"2\"\n")
+			So(string(content), ShouldContainSubstring, "concurrency: ${USERS}\n")
+			So(string(content), ShouldContainSubstring, "base: ${SG_TEST_HOST}/login?user=${USER_NAME}\n")
+			So(string(content), ShouldContainSubstring, `"password": "${PASSWORD}", "literal": "$${USERS}"`)
+			So(string(content), ShouldNotContainSubstring, "secret")
+
+			So(convertCommand([]string{yamlFile, jsonFile}, &bytes.Buffer{}), ShouldEqual, 0)
+			content, _ = ioutil.ReadFile(jsonFile)
+			So(string(content), ShouldContainSubstring, `"concurrency": ${USERS},`)
+			p, err := readProfile(jsonFile)
+			So(err, ShouldBeNil)
+			So(p.Tests[0].Requests[0].Concurrency, ShouldEqual, 2)
+			So(p.Tests[0].Requests[0].Data.Data, ShouldEqual, `{"password": "secret", "literal": "${USERS}"}`)
+		})
+	})
+}